@@ -0,0 +1,80 @@
+package bloomfilter
+
+import (
+	"hash"
+	"sync/atomic"
+)
+
+// AtomicBloomFilter is a lock-free thread safe bloom filter data structure.
+//
+// Unlike BloomFilterTS, it has no mutex: Add sets bits with atomic OR operations on the words
+// of the bit array and Query reads them with atomic loads, so any number of goroutines may add and query
+// concurrently without waiting for each other.
+// Hash functions are either a stateless Hasher or created by factory functions rather than passed as values,
+// so that concurrent calls never share hash state.
+type AtomicBloomFilter struct {
+	hasher           Hasher
+	numHashFunctions uint8
+	size             uint64 //in bits
+	bits             []uint64
+}
+
+// Add takes a byte slice as input and adds it to the AtomicBloomFilter structure's bit array.
+func (abf *AtomicBloomFilter) Add(data []byte) {
+	hash1Val, hash2Val := abf.hasher.Sum128(data)
+
+	for i := uint8(0); i < abf.numHashFunctions; i++ {
+		currLoc := location(hash1Val, hash2Val, i, abf.size)
+		atomic.OrUint64(&abf.bits[currLoc/64], 1<<(currLoc%64))
+	}
+}
+
+// Query tests the byte slice input's existence in the AtomicBloomFilter structure and returns a boolean value.
+// A Query that runs concurrently with an Add of the same byte slice may return either true or false.
+func (abf *AtomicBloomFilter) Query(data []byte) bool {
+	hash1Val, hash2Val := abf.hasher.Sum128(data)
+
+	for i := uint8(0); i < abf.numHashFunctions; i++ {
+		currLoc := location(hash1Val, hash2Val, i, abf.size)
+		if atomic.LoadUint64(&abf.bits[currLoc/64])&(1<<(currLoc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NewAtomicByEstimates returns a new AtomicBloomFilter structure for estimated number of items and
+// estimated false positive rate. For more details, please see NewByEstimates function.
+// newHash1 and newHash2 create the hash functions, and when they are nil, default hash functions are used.
+func NewAtomicByEstimates(numItems uint64, fpRate float64, newHash1 func() hash.Hash64, newHash2 func() hash.Hash64) (*AtomicBloomFilter, error) {
+	return NewAtomicByEstimatesWithHasher(numItems, fpRate, newHasher(newHash1, newHash2))
+}
+
+// NewAtomicBySizeAndNumHashFuncs returns a new AtomicBloomFilter structure for maximum size in bits and
+// number of hash functions. For more details, please see NewBySizeAndNumHashFuncs function.
+// newHash1 and newHash2 create the hash functions, and when they are nil, default hash functions are used.
+func NewAtomicBySizeAndNumHashFuncs(size uint64, numHashFunctions uint8, newHash1 func() hash.Hash64, newHash2 func() hash.Hash64) (*AtomicBloomFilter, error) {
+	return NewAtomicBySizeAndNumHashFuncsWithHasher(size, numHashFunctions, newHasher(newHash1, newHash2))
+}
+
+// NewAtomicByEstimatesWithHasher returns a new AtomicBloomFilter structure for estimated number of items and
+// estimated false positive rate. For more details, please see NewByEstimatesWithHasher function.
+func NewAtomicByEstimatesWithHasher(numItems uint64, fpRate float64, h Hasher) (*AtomicBloomFilter, error) {
+	f, err := New(WithEstimates(numItems, fpRate), WithHasher(h), WithThreadSafety(LockFree))
+	if err != nil {
+		return nil, err
+	}
+
+	return f.(*AtomicBloomFilter), nil
+}
+
+// NewAtomicBySizeAndNumHashFuncsWithHasher returns a new AtomicBloomFilter structure for maximum size in bits and
+// number of hash functions. For more details, please see NewBySizeAndNumHashFuncsWithHasher function.
+func NewAtomicBySizeAndNumHashFuncsWithHasher(size uint64, numHashFunctions uint8, h Hasher) (*AtomicBloomFilter, error) {
+	f, err := New(WithSize(size, numHashFunctions), WithHasher(h), WithThreadSafety(LockFree))
+	if err != nil {
+		return nil, err
+	}
+
+	return f.(*AtomicBloomFilter), nil
+}
@@ -0,0 +1,173 @@
+package bloomfilter
+
+import (
+	"hash"
+	"hash/crc64"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAtomicBloomFilterInit(t *testing.T) {
+	if abf, err := NewAtomicByEstimates(0, 0.01, nil, nil); abf != nil || err != ErrInvalidNumberOfItems {
+		t.Errorf("expected nil atomic bloom filter and error %v, actual %v and %v", ErrInvalidNumberOfItems, abf, err)
+	}
+	if abf, err := NewAtomicByEstimates(100, 1.0, nil, nil); abf != nil || err != ErrInvalidFalsePositiveRate {
+		t.Errorf("expected nil atomic bloom filter and error %v, actual %v and %v", ErrInvalidFalsePositiveRate, abf, err)
+	}
+	if abf, err := NewAtomicBySizeAndNumHashFuncs(0, 3, nil, nil); abf != nil || err != ErrInvalidSize {
+		t.Errorf("expected nil atomic bloom filter and error %v, actual %v and %v", ErrInvalidSize, abf, err)
+	}
+	if abf, err := NewAtomicBySizeAndNumHashFuncs(100, 0, nil, nil); abf != nil || err != ErrInvalidNumberOfHashFunctions {
+		t.Errorf("expected nil atomic bloom filter and error %v, actual %v and %v", ErrInvalidNumberOfHashFunctions, abf, err)
+	}
+}
+
+// An AtomicBloomFilter must set exactly the same bits as a BloomFilter with the same hash functions.
+func TestAtomicBloomFilterMatchesBloomFilter(t *testing.T) {
+	var (
+		count     = 10000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	newCRC64 := func() hash.Hash64 { return crc64.New(crc64.MakeTable(crc64.ECMA)) }
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	for _, newHash2 := range []func() hash.Hash64{nil, newCRC64} {
+		var hash2 hash.Hash64
+		if newHash2 != nil {
+			hash2 = newHash2()
+		}
+		bf, err := NewByEstimates(numItems, fp, nil, hash2)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		abf, err := NewAtomicByEstimates(numItems, fp, nil, newHash2)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+
+		for _, tt := range tests {
+			bf.Add(tt.data)
+			abf.Add(tt.data)
+		}
+		for i := range bf.bits {
+			if bf.bits[i] != abf.bits[i] {
+				t.Errorf("expected word %v of the bit array to be %x, actual %x", i, bf.bits[i], abf.bits[i])
+				break
+			}
+		}
+		for _, tt := range tests {
+			if result := abf.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+		}
+	}
+}
+
+// This test should NOT fail when "go test -race" command is issued.
+// AtomicBloomFilter structure is thread safe.
+func TestAtomicBloomFilterParallel(t *testing.T) {
+	var (
+		count      = 100000
+		numItems   = uint64(count)
+		fp         = 0.01
+		maxStrLen  = 50
+		minStrLen  = 20
+		goroutines = 8
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	abf, err := NewAtomicByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < count; i += goroutines {
+				abf.Add(tests[i].data)
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < count; i += goroutines {
+				abf.Query(tests[(i+count/2)%count].data)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for _, tt := range tests {
+		if result := abf.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+}
+
+func BenchmarkParallelAddTS(b *testing.B) {
+	bfts, err := NewTSByEstimates(1000000, 0.01, nil, nil)
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+	benchmarkParallel(b, bfts.Add)
+}
+
+func BenchmarkParallelAddAtomic(b *testing.B) {
+	abf, err := NewAtomicByEstimates(1000000, 0.01, nil, nil)
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+	benchmarkParallel(b, abf.Add)
+}
+
+func BenchmarkParallelQueryTS(b *testing.B) {
+	bfts, err := NewTSByEstimates(1000000, 0.01, nil, nil)
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+	benchmarkParallel(b, func(data []byte) { bfts.Query(data) })
+}
+
+func BenchmarkParallelQueryAtomic(b *testing.B) {
+	abf, err := NewAtomicByEstimates(1000000, 0.01, nil, nil)
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+	benchmarkParallel(b, func(data []byte) { abf.Query(data) })
+}
+
+// benchmarkParallel calls fn with random test data from all of the benchmark's goroutines.
+func benchmarkParallel(b *testing.B, fn func(data []byte)) {
+	var (
+		count     = 100000
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	var next uint64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddUint64(&next, 7919))
+		for pb.Next() {
+			fn(tests[i%count].data)
+			i++
+		}
+	})
+}
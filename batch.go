@@ -0,0 +1,177 @@
+package bloomfilter
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// batchCheckInterval is the number of elements that a worker of hashMany hashes between checks of its context.
+const batchCheckInterval = 1024
+
+// hashSums holds the two hash values of an element.
+type hashSums struct {
+	hash1Val uint64
+	hash2Val uint64
+}
+
+// hashMany returns the two hash values of every element of data, hashed by workers goroutines that each take
+// a contiguous part of data. When workers is not positive, runtime.GOMAXPROCS(0) goroutines are used.
+// When ctx is done before every element is hashed, the workers stop and ctx.Err() is returned.
+func hashMany(ctx context.Context, h Hasher, data [][]byte, workers int) ([]hashSums, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(data) {
+		workers = len(data)
+	}
+	sums := make([]hashSums, len(data))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start, end := w*len(data)/workers, (w+1)*len(data)/workers
+		wg.Add(1)
+		go func(sums []hashSums, data [][]byte) {
+			defer wg.Done()
+			for i := range data {
+				if i%batchCheckInterval == 0 && ctx.Err() != nil {
+					return
+				}
+				sums[i].hash1Val, sums[i].hash2Val = h.Sum128(data[i])
+			}
+		}(sums[start:end], data[start:end])
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// addSums adds every element whose hash values are in sums and reports whether the estimated false positive rate
+// passed the threshold set by SetFPRateThreshold, as add does.
+func (bf *BloomFilter) addSums(sums []hashSums) bool {
+	passed := false
+	for _, s := range sums {
+		if bf.addHashes(s.hash1Val, s.hash2Val) {
+			passed = true
+		}
+	}
+	return passed
+}
+
+// querySums tests the existence of every element whose hash values are in sums.
+func (bf *BloomFilter) querySums(sums []hashSums) []bool {
+	results := make([]bool, len(sums))
+	for i, s := range sums {
+		results[i] = bf.queryHashes(s.hash1Val, s.hash2Val)
+	}
+	return results
+}
+
+// AddMany adds every byte slice of data to the BloomFilter structure's bit array, as Add does for each of them.
+// When the batch makes the estimated false positive rate reach the threshold set by SetFPRateThreshold,
+// the function is called once, after the whole batch is added.
+func (bf *BloomFilter) AddMany(data [][]byte) {
+	passed := false
+	for _, d := range data {
+		if bf.add(d) {
+			passed = true
+		}
+	}
+	if passed {
+		bf.onThreshold(bf.Stats())
+	}
+}
+
+// QueryMany tests the existence of every byte slice of data in the BloomFilter structure, as Query does for each of them,
+// and returns the results in the order of data.
+func (bf *BloomFilter) QueryMany(data [][]byte) []bool {
+	results := make([]bool, len(data))
+	for i, d := range data {
+		results[i] = bf.Query(d)
+	}
+	return results
+}
+
+// AddManyParallel serves the same purpose as AddMany, but data is hashed by workers goroutines first,
+// which is faster for large batches with expensive hash functions. When workers is not positive,
+// runtime.GOMAXPROCS(0) goroutines are used. Bits are set by the calling goroutine once every element is hashed.
+// When ctx is done before then, nothing is added and ctx.Err() is returned.
+func (bf *BloomFilter) AddManyParallel(ctx context.Context, data [][]byte, workers int) error {
+	sums, err := hashMany(ctx, bf.hasher, data, workers)
+	if err != nil {
+		return err
+	}
+	if bf.addSums(sums) {
+		bf.onThreshold(bf.Stats())
+	}
+	return nil
+}
+
+// QueryManyParallel serves the same purpose as QueryMany, but data is hashed by workers goroutines first.
+// For more details, please see AddManyParallel. When ctx is done before every element is hashed,
+// nil and ctx.Err() are returned.
+func (bf *BloomFilter) QueryManyParallel(ctx context.Context, data [][]byte, workers int) ([]bool, error) {
+	sums, err := hashMany(ctx, bf.hasher, data, workers)
+	if err != nil {
+		return nil, err
+	}
+	return bf.querySums(sums), nil
+}
+
+// AddMany for thread safe BloomFilterTS structure serves the same purpose as AddMany for BloomFilter structure.
+// Structure is locked for writing once for the whole batch, and the function set by SetFPRateThreshold is called
+// after it is unlocked.
+func (bfts *BloomFilterTS) AddMany(data [][]byte) {
+	bfts.mtx.Lock()
+	passed := false
+	for _, d := range data {
+		if bfts.bf.add(d) {
+			passed = true
+		}
+	}
+	bfts.unlockAfterAdd(passed)
+}
+
+// QueryMany for thread safe BloomFilterTS structure serves the same purpose as QueryMany for BloomFilter structure.
+// Structure is locked for reading once for the whole batch.
+func (bfts *BloomFilterTS) QueryMany(data [][]byte) []bool {
+	bfts.mtx.RLock()
+	defer bfts.mtx.RUnlock()
+	return bfts.bf.QueryMany(data)
+}
+
+// AddManyParallel for thread safe BloomFilterTS structure serves the same purpose as AddManyParallel
+// for BloomFilter structure. Elements are hashed without holding the lock, so other goroutines may use
+// the structure in the meantime, and it is locked for writing once to set the bits of the whole batch.
+func (bfts *BloomFilterTS) AddManyParallel(ctx context.Context, data [][]byte, workers int) error {
+	sums, err := hashMany(ctx, bfts.hasher(), data, workers)
+	if err != nil {
+		return err
+	}
+	bfts.mtx.Lock()
+	bfts.unlockAfterAdd(bfts.bf.addSums(sums))
+	return nil
+}
+
+// QueryManyParallel for thread safe BloomFilterTS structure serves the same purpose as QueryManyParallel
+// for BloomFilter structure. Elements are hashed without holding the lock, and it is locked for reading once
+// to test the whole batch.
+func (bfts *BloomFilterTS) QueryManyParallel(ctx context.Context, data [][]byte, workers int) ([]bool, error) {
+	sums, err := hashMany(ctx, bfts.hasher(), data, workers)
+	if err != nil {
+		return nil, err
+	}
+	bfts.mtx.RLock()
+	defer bfts.mtx.RUnlock()
+	return bfts.bf.querySums(sums), nil
+}
+
+// hasher returns the Hasher of the BloomFilterTS structure, which UnmarshalBinary and ReadFrom may replace.
+func (bfts *BloomFilterTS) hasher() Hasher {
+	bfts.mtx.RLock()
+	defer bfts.mtx.RUnlock()
+	return bfts.bf.hasher
+}
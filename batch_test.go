@@ -0,0 +1,288 @@
+package bloomfilter
+
+import (
+	"context"
+	"hash/crc64"
+	"sync"
+	"testing"
+)
+
+// batchFilter is implemented by both BloomFilter and BloomFilterTS structures.
+type batchFilter interface {
+	Filter
+	AddMany(data [][]byte)
+	QueryMany(data [][]byte) []bool
+	AddManyParallel(ctx context.Context, data [][]byte, workers int) error
+	QueryManyParallel(ctx context.Context, data [][]byte, workers int) ([]bool, error)
+}
+
+// AddMany and AddManyParallel must set exactly the same bits as Add, and QueryMany and QueryManyParallel
+// must return the results of Query in the order of their input.
+func TestAddManyQueryMany(t *testing.T) {
+	var (
+		count     = 10000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	negatives := prepTestCases(count, minStrLen, maxStrLen)
+	data := make([][]byte, count)
+	for i, tt := range tests {
+		data[i] = tt.data
+	}
+	queries := make([][]byte, 0, 2*count)
+	for i := range tests {
+		queries = append(queries, tests[i].data, negatives[i].data)
+	}
+
+	expected, err := NewByEstimates(numItems, fp, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, d := range data {
+		expected.Add(d)
+	}
+
+	newFilters := []struct {
+		name      string
+		newFilter func() (batchFilter, error)
+	}{
+		{"BloomFilter", func() (batchFilter, error) { return NewByEstimates(numItems, fp, nil, crc64.New(crc64Table)) }},
+		{"BloomFilterTS", func() (batchFilter, error) { return NewTSByEstimates(numItems, fp, nil, crc64.New(crc64Table)) }},
+	}
+	for _, nf := range newFilters {
+		for _, workers := range []int{-1, 0, 1, 3, 2 * count} {
+			f, err := nf.newFilter()
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			if workers < 0 {
+				f.AddMany(data)
+			} else if err := f.AddManyParallel(context.Background(), data, workers); err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+
+			var bf *BloomFilter
+			switch f := f.(type) {
+			case *BloomFilter:
+				bf = f
+			case *BloomFilterTS:
+				bf = f.bf
+			}
+			if bf.Stats() != expected.Stats() {
+				t.Errorf("%v with %v workers: expected stats %+v, actual %+v", nf.name, workers, expected.Stats(), bf.Stats())
+			}
+			for i := range bf.bits {
+				if bf.bits[i] != expected.bits[i] {
+					t.Errorf("%v with %v workers: expected word %v of the bit array to be %x, actual %x", nf.name, workers, i, expected.bits[i], bf.bits[i])
+					break
+				}
+			}
+
+			results := f.QueryMany(queries)
+			if workers >= 0 {
+				if results, err = f.QueryManyParallel(context.Background(), queries, workers); err != nil {
+					t.Log(err.Error())
+					t.FailNow()
+				}
+			}
+			if len(results) != len(queries) {
+				t.Log("expected a result for every query")
+				t.FailNow()
+			}
+			for i, q := range queries {
+				if e := expected.Query(q); results[i] != e {
+					t.Errorf("%v with %v workers: query %v (%v): expected %v, actual %v", nf.name, workers, i, string(q), e, results[i])
+				}
+			}
+		}
+	}
+}
+
+func TestAddManyEmpty(t *testing.T) {
+	bfts, err := NewTSByEstimates(1000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bfts.AddMany(nil)
+	if err := bfts.AddManyParallel(context.Background(), nil, 0); err != nil {
+		t.Errorf("AddManyParallel of no elements: expected nil error, actual %v", err)
+	}
+	if results, err := bfts.QueryManyParallel(context.Background(), [][]byte{}, 0); err != nil || len(results) != 0 {
+		t.Errorf("QueryManyParallel of no elements: expected no results and nil error, actual %v and %v", results, err)
+	}
+	if stats := bfts.Stats(); stats.Count != 0 {
+		t.Errorf("expected a count of 0, actual %v", stats.Count)
+	}
+}
+
+// Nothing must be added when the context is done before every element is hashed.
+func TestAddManyParallelCanceled(t *testing.T) {
+	data := make([][]byte, 10000)
+	for i := range data {
+		data[i] = []byte{byte(i), byte(i >> 8)}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	bf, err := NewByEstimates(10000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bfts, err := NewTSByEstimates(10000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, f := range []batchFilter{bf, bfts} {
+		if err := f.AddManyParallel(ctx, data, 4); err != context.Canceled {
+			t.Errorf("AddManyParallel: expected error %v, actual %v", context.Canceled, err)
+		}
+		if results, err := f.QueryManyParallel(ctx, data, 4); results != nil || err != context.Canceled {
+			t.Errorf("QueryManyParallel: expected nil results and error %v, actual %v and %v", context.Canceled, results, err)
+		}
+	}
+	if stats := bf.Stats(); stats.Count != 0 || stats.BitsSet != 0 {
+		t.Errorf("expected nothing to be added, actual %+v", stats)
+	}
+	if stats := bfts.Stats(); stats.Count != 0 || stats.BitsSet != 0 {
+		t.Errorf("expected nothing to be added, actual %+v", stats)
+	}
+}
+
+// The function set by SetFPRateThreshold must be called once per batch, after the whole batch is added.
+func TestAddManyFPRateThreshold(t *testing.T) {
+	data := make([][]byte, 2000)
+	for i := range data {
+		data[i] = []byte{byte(i), byte(i >> 8)}
+	}
+
+	bfts, err := NewTSByEstimates(1000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	var calls []Stats
+	bfts.SetFPRateThreshold(0.01, func(stats Stats) {
+		// the lock must be released
+		bfts.Query([]byte("data"))
+		calls = append(calls, stats)
+	})
+	if err := bfts.AddManyParallel(context.Background(), data, 4); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if len(calls) != 1 || calls[0].Count != uint64(len(data)) {
+		t.Errorf("expected a single call after %v elements, actual %+v", len(data), calls)
+	}
+
+	bf, err := NewByEstimates(1000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	calls = nil
+	bf.SetFPRateThreshold(0.01, func(stats Stats) { calls = append(calls, stats) })
+	bf.AddMany(data)
+	bf.AddMany(data)
+	if len(calls) != 1 || calls[0].Count != uint64(len(data)) {
+		t.Errorf("expected a single call after %v elements, actual %+v", len(data), calls)
+	}
+}
+
+// This test should NOT fail when "go test -race" command is issued.
+func TestBloomFilterTSAddManyParallel(t *testing.T) {
+	var (
+		count      = 100000
+		numItems   = uint64(count)
+		fp         = 0.01
+		maxStrLen  = 50
+		minStrLen  = 20
+		goroutines = 4
+		batchSize  = 1000
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	bfts, err := NewTSByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			batch := make([][]byte, 0, batchSize)
+			for i := g; i < count; i += goroutines {
+				batch = append(batch, tests[i].data)
+				if len(batch) == batchSize {
+					if g%2 == 0 {
+						bfts.AddMany(batch)
+					} else if err := bfts.AddManyParallel(context.Background(), batch, 2); err != nil {
+						t.Errorf("AddManyParallel: expected nil error, actual %v", err)
+					}
+					bfts.QueryMany(batch)
+					batch = batch[:0]
+				}
+			}
+			bfts.AddMany(batch)
+		}(g)
+	}
+	wg.Wait()
+
+	for _, tt := range tests {
+		if result := bfts.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+}
+
+func BenchmarkAddTSBatch(b *testing.B) {
+	benchmarkAddManyTS(b, func(bfts *BloomFilterTS, batch [][]byte) {
+		for _, data := range batch {
+			bfts.Add(data)
+		}
+	})
+}
+
+func BenchmarkAddManyTS(b *testing.B) {
+	benchmarkAddManyTS(b, func(bfts *BloomFilterTS, batch [][]byte) {
+		bfts.AddMany(batch)
+	})
+}
+
+func BenchmarkAddManyParallelTS(b *testing.B) {
+	benchmarkAddManyTS(b, func(bfts *BloomFilterTS, batch [][]byte) {
+		bfts.AddManyParallel(context.Background(), batch, 0)
+	})
+}
+
+// benchmarkAddManyTS adds batches of 10000 elements to a BloomFilterTS structure with addBatch.
+// ns/op is per batch.
+func benchmarkAddManyTS(b *testing.B, addBatch func(bfts *BloomFilterTS, batch [][]byte)) {
+	tests := prepTestCases(10000, 20, 50)
+	batch := make([][]byte, len(tests))
+	for i, tt := range tests {
+		batch[i] = tt.data
+	}
+	bfts, err := NewTSByEstimates(1000000, 0.01, nil, nil)
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		addBatch(bfts, batch)
+	}
+}
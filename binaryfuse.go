@@ -0,0 +1,303 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// DefaultFingerprintBits is the number of bits of a fingerprint of a BinaryFuseFilter when none is provided.
+	DefaultFingerprintBits uint8 = 8
+
+	// MaxBuildAttempts is the number of seeds that BuildBinaryFuse tries before it gives up with ErrBuildFailed.
+	// A seed fails when the hash values of the keys form a cycle, which happens to less than one seed in ten.
+	MaxBuildAttempts = 100
+
+	// minSegmentLength and maxSegmentLength are the minimum and maximum number of fingerprints in a segment
+	// of a BinaryFuseFilter.
+	minSegmentLength = 4
+	maxSegmentLength = 1 << 18
+
+	// maxBinaryFuseKeys is the maximum number of keys of a BinaryFuseFilter, so that its number of fingerprints
+	// fits in 32 bits.
+	maxBinaryFuseKeys = 1 << 31
+)
+
+// BinaryFuseFilter is an immutable filter data structure for a set of keys that is known in advance,
+// as described in "Binary Fuse Filters: Fast and Smaller Than Xor Filters" by Graf and Lemire.
+//
+// Every key maps to three fingerprints in three consecutive segments of an array, and the array is built so that
+// the XOR of the three fingerprints of every key is the fingerprint of its hash value. A Query for a key that was not
+// in the set matches with a probability of 2^-fingerprintBits.
+// With 8-bit fingerprints, it takes about 9 bits per key for a false positive rate of 0.4%, and with 16-bit fingerprints,
+// about 18 bits per key for a false positive rate of 0.0015%, much less than a BloomFilter structure with the same
+// false positive rate. Keys can be neither added nor removed after the BinaryFuseFilter structure is built.
+//
+// A BinaryFuseFilter structure is only read after it is built, so it may be queried by any number of goroutines at once.
+type BinaryFuseFilter struct {
+	seed               uint64
+	fingerprintBits    uint8
+	segmentLength      uint32
+	segmentCount       uint32
+	segmentCountLength uint32
+	numKeys            uint64
+	fingerprints       []byte // little endian fingerprints of fingerprintBits/8 bytes each
+}
+
+// Query tests the byte slice input's existence in the BinaryFuseFilter structure and returns a boolean value.
+// As with BloomFilter, false positives are possible, while false negatives are not.
+func (bff *BinaryFuseFilter) Query(data []byte) bool {
+	h := mix64(xxh64(data, 0) + bff.seed)
+	h0, h1, h2 := bff.positions(h)
+
+	return bff.fingerprint(h) == bff.get(h0)^bff.get(h1)^bff.get(h2)
+}
+
+// Len returns the number of distinct keys that the BinaryFuseFilter structure was built from.
+func (bff *BinaryFuseFilter) Len() uint64 {
+	return bff.numKeys
+}
+
+// positions returns the locations of the three fingerprints of a key with hash value h, one in each of
+// three consecutive segments.
+func (bff *BinaryFuseFilter) positions(h uint64) (uint32, uint32, uint32) {
+	hi, _ := bits.Mul64(h, uint64(bff.segmentCountLength))
+	mask := bff.segmentLength - 1
+	h0 := uint32(hi)
+	h1 := (h0 + bff.segmentLength) ^ (uint32(h>>18) & mask)
+	h2 := (h0 + 2*bff.segmentLength) ^ (uint32(h) & mask)
+	return h0, h1, h2
+}
+
+// fingerprint returns the fingerprint of a key with hash value h.
+func (bff *BinaryFuseFilter) fingerprint(h uint64) uint16 {
+	return uint16(h^(h>>32)) & uint16(1<<bff.fingerprintBits-1)
+}
+
+func (bff *BinaryFuseFilter) get(i uint32) uint16 {
+	if bff.fingerprintBits == 8 {
+		return uint16(bff.fingerprints[i])
+	}
+	return binary.LittleEndian.Uint16(bff.fingerprints[2*i:])
+}
+
+func (bff *BinaryFuseFilter) set(i uint32, v uint16) {
+	if bff.fingerprintBits == 8 {
+		bff.fingerprints[i] = uint8(v)
+		return
+	}
+	binary.LittleEndian.PutUint16(bff.fingerprints[2*i:], v)
+}
+
+// newBinaryFuseFilter returns an empty BinaryFuseFilter structure with the segment length and number of segments
+// of the reference implementation for numKeys keys.
+func newBinaryFuseFilter(numKeys uint64, fingerprintBits uint8) *BinaryFuseFilter {
+	segmentLength := uint32(maxSegmentLength)
+	if l := math.Floor(math.Log(float64(numKeys))/math.Log(3.33) + 2.25); l < 18 {
+		segmentLength = 1 << uint(l)
+	}
+	var capacity uint64
+	if numKeys > 1 {
+		sizeFactor := math.Max(1.125, 0.875+0.25*math.Log(1000000)/math.Log(float64(numKeys)))
+		capacity = uint64(math.Round(float64(numKeys) * sizeFactor))
+	}
+	segmentCount := uint32(1)
+	if n := (capacity + uint64(segmentLength) - 1) / uint64(segmentLength); n > 2 {
+		segmentCount = uint32(n - 2)
+	}
+
+	bff := BinaryFuseFilter{
+		fingerprintBits:    fingerprintBits,
+		segmentLength:      segmentLength,
+		segmentCount:       segmentCount,
+		segmentCountLength: segmentCount * segmentLength,
+		numKeys:            numKeys,
+	}
+	bff.fingerprints = make([]byte, uint64(segmentCount+2)*uint64(segmentLength)*uint64(fingerprintBits/8))
+
+	return &bff
+}
+
+// BuildBinaryFuse builds a BinaryFuseFilter structure from keys, with fingerprints of fingerprintBits bits,
+// which is either 8 or 16. When fingerprintBits is 0, DefaultFingerprintBits is used.
+// Keys are hashed with XXH64, and duplicate keys are allowed.
+// Building tries up to MaxBuildAttempts seeds until the hash values of the keys form no cycle, and returns ErrBuildFailed
+// when none of them succeeds, which practically never happens for distinct keys.
+// ErrInvalidNumberOfItems is returned when there are no keys or more than 2^31 keys.
+func BuildBinaryFuse(keys [][]byte, fingerprintBits uint8) (*BinaryFuseFilter, error) {
+	if fingerprintBits == 0 {
+		fingerprintBits = DefaultFingerprintBits
+	}
+	if fingerprintBits != 8 && fingerprintBits != 16 {
+		return nil, ErrInvalidFingerprintBits
+	}
+	if len(keys) == 0 || uint64(len(keys)) > maxBinaryFuseKeys {
+		return nil, ErrInvalidNumberOfItems
+	}
+
+	// duplicate keys would form a cycle with every seed
+	hashes := make([]uint64, len(keys))
+	for i, key := range keys {
+		hashes[i] = xxh64(key, 0)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	n := 0
+	for i, h := range hashes {
+		if i == 0 || h != hashes[n-1] {
+			hashes[n] = h
+			n++
+		}
+	}
+	hashes = hashes[:n]
+
+	bff := newBinaryFuseFilter(uint64(n), fingerprintBits)
+	size := len(bff.fingerprints) / int(fingerprintBits/8)
+	counts := make([]uint32, size)
+	xors := make([]uint64, size)
+	alone := make([]uint32, 0, size)
+	type peeled struct {
+		h    uint64
+		cell uint32
+	}
+	order := make([]peeled, 0, n)
+
+	seed := uint64(0)
+	for attempt := 0; attempt < MaxBuildAttempts; attempt++ {
+		seed = mix64(seed + 0x9e3779b97f4a7c15)
+		bff.seed = seed
+		for i := range counts {
+			counts[i], xors[i] = 0, 0
+		}
+		alone, order = alone[:0], order[:0]
+
+		for _, k := range hashes {
+			h := mix64(k + seed)
+			h0, h1, h2 := bff.positions(h)
+			for _, c := range [3]uint32{h0, h1, h2} {
+				counts[c]++
+				xors[c] ^= h
+			}
+		}
+
+		// peel keys that are alone in a cell, until no cell has a single key
+		for c, count := range counts {
+			if count == 1 {
+				alone = append(alone, uint32(c))
+			}
+		}
+		for len(alone) > 0 {
+			c := alone[len(alone)-1]
+			alone = alone[:len(alone)-1]
+			if counts[c] != 1 {
+				continue
+			}
+			h := xors[c]
+			order = append(order, peeled{h: h, cell: c})
+			h0, h1, h2 := bff.positions(h)
+			for _, o := range [3]uint32{h0, h1, h2} {
+				counts[o]--
+				xors[o] ^= h
+				if counts[o] == 1 {
+					alone = append(alone, o)
+				}
+			}
+		}
+		if len(order) == n {
+			break
+		}
+	}
+	if len(order) != n {
+		return nil, ErrBuildFailed
+	}
+
+	// the cell of a key is set after the cells of every key that was peeled later, none of which use it
+	for i := len(order) - 1; i >= 0; i-- {
+		h, c := order[i].h, order[i].cell
+		h0, h1, h2 := bff.positions(h)
+		bff.set(c, bff.fingerprint(h)^bff.get(h0)^bff.get(h1)^bff.get(h2))
+	}
+
+	return bff, nil
+}
+
+// A serialized BinaryFuseFilter has the following layout, all integers being little endian:
+//
+//	offset  length  field
+//	0       4       magic "BLMX"
+//	4       1       format version
+//	5       1       number of bits of a fingerprint
+//	6       2       reserved, zero
+//	8       8       seed
+//	16      4       segment length
+//	20      4       number of segments
+//	24      8       number of keys
+//	32      n       fingerprints, n = (number of segments + 2) * segment length * bits of a fingerprint / 8
+//	32+n    4       CRC-32C of all preceding bytes
+const (
+	binaryFuseEncodingMagic   = "BLMX"
+	binaryFuseEncodingVersion = 1
+	binaryFuseHeaderLen       = 32
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The returned byte slice holds the parameters and the fingerprints of the BinaryFuseFilter structure,
+// followed by a checksum.
+func (bff *BinaryFuseFilter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, binaryFuseHeaderLen+len(bff.fingerprints)+checksumLen)
+	copy(data[0:4], binaryFuseEncodingMagic)
+	data[4] = binaryFuseEncodingVersion
+	data[5] = bff.fingerprintBits
+	binary.LittleEndian.PutUint64(data[8:16], bff.seed)
+	binary.LittleEndian.PutUint32(data[16:20], bff.segmentLength)
+	binary.LittleEndian.PutUint32(data[20:24], bff.segmentCount)
+	binary.LittleEndian.PutUint64(data[24:32], bff.numKeys)
+	copy(data[binaryFuseHeaderLen:], bff.fingerprints)
+	end := len(data) - checksumLen
+	binary.LittleEndian.PutUint32(data[end:], crc32.Checksum(data[:end], castagnoli))
+
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (bff *BinaryFuseFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < binaryFuseHeaderLen+checksumLen || string(data[0:4]) != binaryFuseEncodingMagic {
+		return ErrInvalidEncoding
+	}
+	if data[4] != binaryFuseEncodingVersion {
+		return ErrUnsupportedVersion
+	}
+	fingerprintBits := data[5]
+	segmentLength := binary.LittleEndian.Uint32(data[16:20])
+	segmentCount := binary.LittleEndian.Uint32(data[20:24])
+	if (fingerprintBits != 8 && fingerprintBits != 16) ||
+		segmentLength < minSegmentLength || segmentLength > maxSegmentLength || segmentLength&(segmentLength-1) != 0 ||
+		segmentCount == 0 {
+		return ErrInvalidEncoding
+	}
+	// the array holds two more segments than segmentCount, and its length must fit in 32 bits
+	arrayLength := (uint64(segmentCount) + 2) * uint64(segmentLength)
+	if arrayLength > math.MaxUint32 ||
+		uint64(len(data)) != binaryFuseHeaderLen+arrayLength*uint64(fingerprintBits/8)+checksumLen {
+		return ErrInvalidEncoding
+	}
+	end := len(data) - checksumLen
+	if crc32.Checksum(data[:end], castagnoli) != binary.LittleEndian.Uint32(data[end:]) {
+		return ErrChecksumMismatch
+	}
+
+	loaded := BinaryFuseFilter{
+		seed:               binary.LittleEndian.Uint64(data[8:16]),
+		fingerprintBits:    fingerprintBits,
+		segmentLength:      segmentLength,
+		segmentCount:       segmentCount,
+		segmentCountLength: segmentCount * segmentLength,
+		numKeys:            binary.LittleEndian.Uint64(data[24:32]),
+		fingerprints:       append([]byte(nil), data[binaryFuseHeaderLen:end]...),
+	}
+	*bff = loaded
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"testing"
+)
+
+func TestBuildBinaryFuseInit(t *testing.T) {
+	if bff, err := BuildBinaryFuse(nil, 8); bff != nil || err != ErrInvalidNumberOfItems {
+		t.Errorf("expected nil binary fuse filter and error %v, actual %v and %v", ErrInvalidNumberOfItems, bff, err)
+	}
+	if bff, err := BuildBinaryFuse([][]byte{[]byte("data")}, 12); bff != nil || err != ErrInvalidFingerprintBits {
+		t.Errorf("expected nil binary fuse filter and error %v, actual %v and %v", ErrInvalidFingerprintBits, bff, err)
+	}
+	bff, err := BuildBinaryFuse([][]byte{[]byte("data")}, 0)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if bff.fingerprintBits != DefaultFingerprintBits {
+		t.Errorf("expected %v bits of a fingerprint, actual %v", DefaultFingerprintBits, bff.fingerprintBits)
+	}
+}
+
+func TestBinaryFuseFilter(t *testing.T) {
+	var (
+		count     = 100000
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	negatives := prepTestCases(count, minStrLen, maxStrLen)
+	keys := make([][]byte, count)
+	for i, tt := range tests {
+		keys[i] = tt.data
+	}
+
+	for _, fingerprintBits := range []uint8{8, 16} {
+		bff, err := BuildBinaryFuse(keys, fingerprintBits)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		for _, tt := range tests {
+			if result := bff.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+		}
+
+		fp := 1 / float64(uint64(1)<<fingerprintBits)
+		fps := 0
+		for _, tt := range negatives {
+			if bff.Query(tt.data) {
+				fps++
+			}
+		}
+		// with 16-bit fingerprints only a few false positives are expected, so allow for 4 standard deviations
+		if rate := float64(fps) / float64(count); rate > fp*(1+acceptableAdditionalFalsePositiveErrorRate)+4*math.Sqrt(fp/float64(count)) {
+			t.Errorf("%v bits: expected false positive rate close to %v, actual %v", fingerprintBits, fp, rate)
+		}
+	}
+}
+
+// With 8-bit fingerprints, a binary fuse filter of many keys must take about 9 bits per key.
+func TestBinaryFuseFilterBitsPerKey(t *testing.T) {
+	count := 1000000
+	keys := make([][]byte, count)
+	for i := range keys {
+		keys[i] = make([]byte, 8)
+		binary.LittleEndian.PutUint64(keys[i], uint64(i))
+	}
+	bff, err := BuildBinaryFuse(keys, 8)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if bitsPerKey := float64(8*len(bff.fingerprints)) / float64(count); bitsPerKey > 9.5 {
+		t.Errorf("expected about 9 bits per key, actual %v", bitsPerKey)
+	}
+	for _, key := range keys {
+		if !bff.Query(key) {
+			t.Errorf("Query(%x): expected %v, actual %v", key, true, false)
+			break
+		}
+	}
+}
+
+// Small and duplicate key sets must build as well, retrying seeds as needed.
+func TestBinaryFuseFilterSmall(t *testing.T) {
+	for n := 1; n <= 200; n++ {
+		tests := prepTestCases(n, 1, 10)
+		keys := make([][]byte, 0, 2*n)
+		for _, tt := range tests {
+			keys = append(keys, tt.data, tt.data)
+		}
+		bff, err := BuildBinaryFuse(keys, 16)
+		if err != nil {
+			t.Errorf("BuildBinaryFuse(%v keys): expected nil error, actual %v", n, err)
+			continue
+		}
+		for _, tt := range tests {
+			if result := bff.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+		}
+		if bff.Len() > uint64(n) {
+			t.Errorf("Len: expected at most %v distinct keys, actual %v", n, bff.Len())
+		}
+	}
+}
+
+func TestBinaryFuseFilterMarshalBinary(t *testing.T) {
+	var (
+		count     = 10000
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	keys := make([][]byte, count)
+	for i, tt := range tests {
+		keys[i] = tt.data
+	}
+	bff, err := BuildBinaryFuse(keys, 16)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	data, err := bff.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var loaded BinaryFuseFilter
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		if result := loaded.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+	again, _ := loaded.MarshalBinary()
+	if !bytes.Equal(data, again) {
+		t.Errorf("expected loaded binary fuse filter to marshal to the same bytes")
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[binaryFuseHeaderLen] ^= 1
+	versioned := append([]byte(nil), data...)
+	versioned[4] = 99
+	// segmentCount+2 wraps around to 1 in 32 bits, which made a single fingerprint look like the whole array
+	wrapped := append([]byte(nil), data[:binaryFuseHeaderLen]...)
+	wrapped[5] = 8
+	binary.LittleEndian.PutUint32(wrapped[16:20], 1)
+	binary.LittleEndian.PutUint32(wrapped[20:24], 0xFFFFFFFF)
+	wrapped = append(wrapped, 0)
+	wrapped = binary.LittleEndian.AppendUint32(wrapped, crc32.Checksum(wrapped, castagnoli))
+	shortSegments := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(shortSegments[16:20], 2)
+	errorTests := []struct {
+		description string
+		data        []byte
+		err         error
+	}{
+		{"empty", nil, ErrInvalidEncoding},
+		{"truncated", data[:len(data)-1], ErrInvalidEncoding},
+		{"magic", append([]byte("BLMC"), data[4:]...), ErrInvalidEncoding},
+		{"version", versioned, ErrUnsupportedVersion},
+		{"checksum", corrupted, ErrChecksumMismatch},
+		{"wrapped array length", wrapped, ErrInvalidEncoding},
+		{"segment length of 2", shortSegments, ErrInvalidEncoding},
+	}
+	for _, tt := range errorTests {
+		var bff BinaryFuseFilter
+		if err := bff.UnmarshalBinary(tt.data); err != tt.err {
+			t.Errorf("%v: expected error %v, actual %v", tt.description, tt.err, err)
+		}
+	}
+}
+
+func BenchmarkBuildBinaryFuse(b *testing.B) {
+	count := 1000000
+	keys := make([][]byte, count)
+	for i := range keys {
+		keys[i] = make([]byte, 8)
+		binary.LittleEndian.PutUint64(keys[i], uint64(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := BuildBinaryFuse(keys, 8); err != nil {
+			b.Log(err.Error())
+			b.FailNow()
+		}
+	}
+}
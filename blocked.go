@@ -0,0 +1,209 @@
+package bloomfilter
+
+import (
+	"hash"
+	"math"
+	"math/bits"
+	"unsafe"
+)
+
+const (
+	// blockBits is the size of a block of BlockedBloomFilter in bits, which is the size of a cache line on most CPUs.
+	blockBits = 512
+
+	// blockWords is the number of uint64 words in a block.
+	blockWords = blockBits / 64
+)
+
+// BlockedBloomFilter is a non-thread safe bloom filter data structure that maps every element to a single
+// 512-bit block and sets all of its bits inside that block.
+//
+// Blocks are aligned to 64 bytes, so that Add and Query touch a single cache line rather than numHashFunctions
+// random words of a potentially huge bit array, which makes them much faster once the bit array does not fit in the CPU caches.
+// In exchange, some blocks receive more elements than others, which raises the false positive rate for the same size;
+// NewBlockedByEstimates compensates for that with a larger bit array than NewByEstimates.
+// Blocks and the locations inside them are taken from the high bits of the hash values, which FNV does not mix
+// well enough for similar elements such as "key-1" and "key-2", so the default hash function is XXH64 rather than FNV.
+type BlockedBloomFilter struct {
+	hasher           Hasher
+	numHashFunctions uint8
+	numBlocks        uint64
+	blocks           []uint64 // numBlocks*blockWords words
+}
+
+// Add takes a byte slice as input and adds it to the BlockedBloomFilter structure's bit array.
+func (bbf *BlockedBloomFilter) Add(data []byte) {
+	hash1Val, hash2Val := bbf.hasher.Sum128(data)
+	block := bbf.block(hash1Val)
+
+	for i := uint8(0); i < bbf.numHashFunctions; i++ {
+		hash2Val *= blockMultiplier
+		loc := hash2Val >> (64 - 9)
+		block[loc/64] |= 1 << (loc % 64)
+	}
+}
+
+// Query tests the byte slice input's existence in the BlockedBloomFilter structure and returns a boolean value.
+// As with BloomFilter, false positives are possible, while false negatives are not.
+func (bbf *BlockedBloomFilter) Query(data []byte) bool {
+	hash1Val, hash2Val := bbf.hasher.Sum128(data)
+	block := bbf.block(hash1Val)
+
+	for i := uint8(0); i < bbf.numHashFunctions; i++ {
+		hash2Val *= blockMultiplier
+		loc := hash2Val >> (64 - 9)
+		if block[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// block returns the block of an element whose first hash value is hash1Val.
+// The high bits of the product of hash1Val and numBlocks are used instead of a modulo, which is much slower.
+func (bbf *BlockedBloomFilter) block(hash1Val uint64) []uint64 {
+	i, _ := bits.Mul64(hash1Val, bbf.numBlocks)
+	return bbf.blocks[i*blockWords : (i+1)*blockWords : (i+1)*blockWords]
+}
+
+// blockMultiplier is an odd constant that the second hash value of an element is multiplied by once per location
+// inside its block. Every multiplication moves the low bits of the hash value up to the high bits that the location
+// is taken from, so that locations are nearly independent, which double hashing does not achieve in a range of only 512.
+const blockMultiplier = 0x9e3779b97f4a7c15
+
+// blockedFPRate returns the false positive rate of a BlockedBloomFilter structure of numBlocks blocks and
+// numHashFunctions hash functions that holds numItems items.
+// The number of items in a block follows a Poisson distribution, and the false positive rate is the average of
+// the false positive rates of 512-bit bloom filters holding that many items, as given by Putze, Sanders and Singler
+// in "Cache-, Hash- and Space-Efficient Bloom Filters".
+func blockedFPRate(numBlocks uint64, numHashFunctions uint8, numItems uint64) float64 {
+	lambda := float64(numItems) / float64(numBlocks)
+	k := float64(numHashFunctions)
+	max := int(lambda + 10*math.Sqrt(lambda) + 10)
+
+	fpRate := 0.0
+	for i := 1; i <= max; i++ {
+		lgamma, _ := math.Lgamma(float64(i) + 1)
+		p := math.Exp(-lambda + float64(i)*math.Log(lambda) - lgamma)
+		fpRate += p * math.Pow(-math.Expm1(k*float64(i)*math.Log1p(-1.0/blockBits)), k)
+	}
+	return fpRate
+}
+
+// blockedEstimates returns the number of blocks and the number of hash functions of a BlockedBloomFilter structure
+// that holds numItems items with a false positive rate of fpRate.
+// It starts from the size of a BloomFilter structure and grows it until the number of hash functions that minimizes
+// blockedFPRate brings the false positive rate down to fpRate. As with estimates, ErrSizeOverflow is returned
+// when the size would be larger than MaxSize.
+func blockedEstimates(numItems uint64, fpRate float64) (uint64, uint8, error) {
+	size, numHashFunctions, err := estimates(numItems, fpRate)
+	if err != nil {
+		return 0, 0, err
+	}
+	numBlocks := (size + blockBits - 1) / blockBits
+
+	maxHashFunctions := uint8(math.MaxUint8)
+	if numHashFunctions < maxHashFunctions-8 {
+		maxHashFunctions = numHashFunctions + 8
+	}
+
+	for {
+		best, bestFPRate := uint8(1), math.Inf(1)
+		for k := uint8(1); k <= maxHashFunctions && k != 0; k++ {
+			if r := blockedFPRate(numBlocks, k, numItems); r < bestFPRate {
+				best, bestFPRate = k, r
+			}
+		}
+		if bestFPRate <= fpRate {
+			return numBlocks, best, nil
+		}
+		numBlocks += numBlocks/64 + 1
+		if numBlocks > MaxSize/blockBits {
+			return 0, 0, ErrSizeOverflow
+		}
+	}
+}
+
+// NewBlockedByEstimates requires estimated number of items and estimated false positive rate to create a
+// BlockedBloomFilter structure. The size in bits is a multiple of 512 and is calculated, along with the ideal number
+// of hash functions, so that the false positive rate stays below fpRate despite blocking. This takes 2 to 15 percent
+// more bits than a BloomFilter structure with the same estimates for false positive rates down to 0.0001,
+// and more for lower false positive rates.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when both are nil, the Hasher returned by NewXXHasher(0)
+// will be used. When only one of them is nil, a default hash.Hash64 will be used in its place.
+func NewBlockedByEstimates(numItems uint64, fpRate float64, hash1 hash.Hash64, hash2 hash.Hash64) (*BlockedBloomFilter, error) {
+	return NewBlockedByEstimatesWithHasher(numItems, fpRate, blockedHasherOf(hash1, hash2))
+}
+
+// NewBlockedBySizeAndNumHashFuncs requires maximum size in bits and number of hash functions to create a
+// BlockedBloomFilter structure. size is rounded up to a multiple of 512.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil, as in NewBlockedByEstimates.
+func NewBlockedBySizeAndNumHashFuncs(size uint64, numHashFunctions uint8, hash1 hash.Hash64, hash2 hash.Hash64) (*BlockedBloomFilter, error) {
+	return NewBlockedBySizeAndNumHashFuncsWithHasher(size, numHashFunctions, blockedHasherOf(hash1, hash2))
+}
+
+// blockedHasherOf returns the Hasher for hash1 and hash2 as hasherOf does, except that it returns nil
+// when both are nil, so that the default Hasher of BlockedBloomFilter is used.
+func blockedHasherOf(hash1 hash.Hash64, hash2 hash.Hash64) Hasher {
+	if hash1 == nil && hash2 == nil {
+		return nil
+	}
+	return hasherOf(hash1, hash2)
+}
+
+// NewBlockedByEstimatesWithHasher returns a new BlockedBloomFilter structure. For more details, please see
+// NewBlockedByEstimates and NewByEstimatesWithHasher functions. h can be nil and when it is nil, the Hasher
+// returned by NewXXHasher(0) will be used.
+func NewBlockedByEstimatesWithHasher(numItems uint64, fpRate float64, h Hasher) (*BlockedBloomFilter, error) {
+	if numItems == 0 {
+		return nil, ErrInvalidNumberOfItems
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, ErrInvalidFalsePositiveRate
+	}
+	numBlocks, numHashFunctions, err := blockedEstimates(numItems, fpRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBlockedBySizeAndNumHashFuncsWithHasher(numBlocks*blockBits, numHashFunctions, h)
+}
+
+// NewBlockedBySizeAndNumHashFuncsWithHasher returns a new BlockedBloomFilter structure. For more details, please see
+// NewBlockedBySizeAndNumHashFuncs and NewBySizeAndNumHashFuncsWithHasher functions. h can be nil and when it is nil,
+// the Hasher returned by NewXXHasher(0) will be used.
+func NewBlockedBySizeAndNumHashFuncsWithHasher(size uint64, numHashFunctions uint8, h Hasher) (*BlockedBloomFilter, error) {
+	if size == 0 {
+		return nil, ErrInvalidSize
+	}
+	if size > MaxSize {
+		return nil, ErrSizeOverflow
+	}
+	if numHashFunctions == 0 {
+		return nil, ErrInvalidNumberOfHashFunctions
+	}
+	if h == nil {
+		h = NewXXHasher(0)
+	}
+	numBlocks := (size + blockBits - 1) / blockBits
+
+	bbf := BlockedBloomFilter{
+		hasher:           h,
+		numHashFunctions: numHashFunctions,
+		numBlocks:        numBlocks,
+		blocks:           alignedWords(numBlocks * blockWords),
+	}
+
+	return &bbf, nil
+}
+
+// alignedWords returns a slice of n uint64 words whose first word is aligned to 64 bytes,
+// so that every block of a BlockedBloomFilter structure lies in a single cache line.
+func alignedWords(n uint64) []uint64 {
+	words := make([]uint64, n+blockWords-1)
+	offset := 0
+	if rem := uintptr(unsafe.Pointer(&words[0])) % (blockWords * 8); rem != 0 {
+		offset = int((blockWords*8 - rem) / 8)
+	}
+	return words[offset : uint64(offset)+n : uint64(offset)+n]
+}
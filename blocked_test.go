@@ -0,0 +1,227 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"unsafe"
+)
+
+func TestBlockedBloomFilterInit(t *testing.T) {
+	if bbf, err := NewBlockedByEstimates(0, 0.01, nil, nil); bbf != nil || err != ErrInvalidNumberOfItems {
+		t.Errorf("expected nil blocked bloom filter and error %v, actual %v and %v", ErrInvalidNumberOfItems, bbf, err)
+	}
+	if bbf, err := NewBlockedByEstimates(100, 0.0, nil, nil); bbf != nil || err != ErrInvalidFalsePositiveRate {
+		t.Errorf("expected nil blocked bloom filter and error %v, actual %v and %v", ErrInvalidFalsePositiveRate, bbf, err)
+	}
+	if bbf, err := NewBlockedBySizeAndNumHashFuncs(0, 3, nil, nil); bbf != nil || err != ErrInvalidSize {
+		t.Errorf("expected nil blocked bloom filter and error %v, actual %v and %v", ErrInvalidSize, bbf, err)
+	}
+	if bbf, err := NewBlockedBySizeAndNumHashFuncs(100, 0, nil, nil); bbf != nil || err != ErrInvalidNumberOfHashFunctions {
+		t.Errorf("expected nil blocked bloom filter and error %v, actual %v and %v", ErrInvalidNumberOfHashFunctions, bbf, err)
+	}
+
+	bbf, err := NewBlockedBySizeAndNumHashFuncs(1000, 3, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if bbf.numBlocks != 2 || len(bbf.blocks) != 2*blockWords {
+		t.Errorf("expected size to be rounded up to 2 blocks, actual %v blocks of %v words", bbf.numBlocks, len(bbf.blocks))
+	}
+}
+
+func TestBlockedBloomFilterAlignment(t *testing.T) {
+	for n := uint64(1); n <= 64; n++ {
+		words := alignedWords(n * blockWords)
+		if uint64(len(words)) != n*blockWords {
+			t.Errorf("alignedWords(%v): expected %v words, actual %v", n*blockWords, n*blockWords, len(words))
+		}
+		if addr := uintptr(unsafe.Pointer(&words[0])); addr%64 != 0 {
+			t.Errorf("alignedWords(%v): expected address aligned to 64 bytes, actual %x", n*blockWords, addr)
+		}
+	}
+}
+
+// Blocked sizing must compensate for the uneven number of items per block, which takes more bits than
+// a BloomFilter structure, but not many more.
+func TestBlockedEstimates(t *testing.T) {
+	for _, numItems := range []uint64{1000, 1000000, 100000000} {
+		for _, fp := range []float64{0.1, 0.01, 0.001, 0.0001} {
+			numBlocks, numHashFunctions, err := blockedEstimates(numItems, fp)
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			size, _, _ := estimates(numItems, fp)
+			if r := blockedFPRate(numBlocks, numHashFunctions, numItems); r > fp {
+				t.Errorf("blockedEstimates(%v, %v): expected false positive rate at most %v, actual %v", numItems, fp, fp, r)
+			}
+			if blocked := numBlocks * blockBits; blocked < size || float64(blocked) > 1.5*float64(size) {
+				t.Errorf("blockedEstimates(%v, %v): expected between %v and %v bits, actual %v", numItems, fp, size, 1.5*float64(size), blocked)
+			}
+		}
+	}
+}
+
+func TestBlockedBloomFilter(t *testing.T) {
+	var (
+		count     = 100000
+		numItems  = uint64(count)
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	negatives := prepTestCases(count, minStrLen, maxStrLen)
+
+	for _, fp := range []float64{0.05, 0.01, 0.001} {
+		// blocks are selected by, and locations inside them taken from, the high bits of the hash values,
+		// which need a better mixed hash function than FNV for the false positive rate to be close to fp
+		bbf, err := NewBlockedByEstimatesWithHasher(numItems, fp, NewXXHasher(0))
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		for _, tt := range tests {
+			bbf.Add(tt.data)
+		}
+		for _, tt := range tests {
+			if result := bbf.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+		}
+
+		fps := 0
+		for _, tt := range negatives {
+			if bbf.Query(tt.data) {
+				fps++
+			}
+		}
+		if rate := float64(fps) / float64(count); rate > fp*(1+acceptableAdditionalFalsePositiveErrorRate) {
+			t.Errorf("expected false positive rate close to %v, actual %v", fp, rate)
+		}
+	}
+}
+
+// The default hash function must keep the false positive rate close to fp for similar elements,
+// which FNV does not mix well enough for the high bits that blocks are selected by.
+func TestBlockedBloomFilterDefaultHasher(t *testing.T) {
+	var (
+		count    = 100000
+		numItems = uint64(count)
+	)
+
+	for _, fp := range []float64{0.05, 0.01, 0.001} {
+		bbf, err := NewBlockedByEstimates(numItems, fp, nil, nil)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		for i := 0; i < count; i++ {
+			bbf.Add([]byte(fmt.Sprintf("key-%v", i)))
+		}
+		for i := 0; i < count; i++ {
+			if result := bbf.Query([]byte(fmt.Sprintf("key-%v", i))); !result {
+				t.Errorf("Query(key-%v): expected %v, actual %v", i, true, false)
+			}
+		}
+
+		fps := 0
+		for i := count; i < 2*count; i++ {
+			if bbf.Query([]byte(fmt.Sprintf("key-%v", i))) {
+				fps++
+			}
+		}
+		if rate := float64(fps) / float64(count); rate > fp*(1+acceptableAdditionalFalsePositiveErrorRate) {
+			t.Errorf("expected false positive rate close to %v, actual %v", fp, rate)
+		}
+	}
+}
+
+func TestBlockedBloomFilterAllocs(t *testing.T) {
+	data := []byte("data")
+	bbf, err := NewBlockedBySizeAndNumHashFuncs(1000, 7, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if allocs := testing.AllocsPerRun(100, func() { bbf.Add(data) }); allocs != 0 {
+		t.Errorf("Add: expected 0 allocations, actual %v", allocs)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { bbf.Query(data) }); allocs != 0 {
+		t.Errorf("Query: expected 0 allocations, actual %v", allocs)
+	}
+}
+
+// blockedBenchmarkSizes are the numbers of items of the bloom filters that BlockedBloomFilter is compared
+// with BloomFilter at. Bloom filters for 1e8 items take 120MB and more, far more than CPU caches.
+var blockedBenchmarkSizes = []uint64{1e6, 1e7, 1e8}
+
+// benchmarkFilters caches filled bloom filters by number of items, since filling the largest ones takes seconds
+// and benchmark functions are run several times.
+var benchmarkFilters = map[string]Filter{}
+
+// benchmarkFilter returns a bloom filter created by newFilter for numItems items, with numItems items added to it.
+// Items are the little-endian encodings of 0 to numItems-1.
+func benchmarkFilter(b *testing.B, name string, numItems uint64, newFilter func() (Filter, error)) Filter {
+	key := fmt.Sprintf("%v/%v", name, numItems)
+	if f, ok := benchmarkFilters[key]; ok {
+		return f
+	}
+	f, err := newFilter()
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+	data := make([]byte, 8)
+	for i := uint64(0); i < numItems; i++ {
+		binary.LittleEndian.PutUint64(data, i)
+		f.Add(data)
+	}
+	benchmarkFilters[key] = f
+	return f
+}
+
+func benchmarkBlocked(b *testing.B, query bool) {
+	const fp = 0.01
+	for _, numItems := range blockedBenchmarkSizes {
+		numItems := numItems
+		filters := []struct {
+			name      string
+			newFilter func() (Filter, error)
+		}{
+			{"BloomFilter", func() (Filter, error) {
+				return NewByEstimatesWithHasher(numItems, fp, NewXXHasher(0))
+			}},
+			{"BlockedBloomFilter", func() (Filter, error) {
+				return NewBlockedByEstimatesWithHasher(numItems, fp, NewXXHasher(0))
+			}},
+		}
+		for _, ff := range filters {
+			b.Run(fmt.Sprintf("%v/%v", ff.name, numItems), func(b *testing.B) {
+				f := benchmarkFilter(b, ff.name, numItems, ff.newFilter)
+				data := make([]byte, 8)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// a multiplicative hash of i spreads consecutive iterations over the filter
+					binary.LittleEndian.PutUint64(data, uint64(i)*0x9e3779b97f4a7c15%numItems)
+					if query {
+						f.Query(data)
+					} else {
+						f.Add(data)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkBlockedAdd(b *testing.B) {
+	benchmarkBlocked(b, false)
+}
+
+func BenchmarkBlockedQuery(b *testing.B) {
+	benchmarkBlocked(b, true)
+}
@@ -55,6 +55,41 @@
 // 
 //     bfts := NewTSBySizeAndNumHashFuncs(size uint64, numHashFunctions uint8, hash1 hash.Hash64, hash2 hash.Hash64)
 //
+// BloomFilterTS serializes all calls with a single lock. A lock-free alternative that sets and tests bits with
+// atomic operations, and that creates its hash functions with factory functions so that concurrent calls never share
+// hash state, is created by:
+//
+//     abf := NewAtomicByEstimates(numItems uint64, fpRate float64, newHash1 func() hash.Hash64, newHash2 func() hash.Hash64)
+//
+// Between the two, a sharded bloom filter routes every element by a prefix of its hash value to one of numShards
+// BloomFilter shards, each with a lock of its own, so goroutines only wait for each other when they use the same shard.
+// The shards are sized together for numItems and fpRate, and Stats merges their statistics:
+//
+//     sbf := NewShardedByEstimates(numItems uint64, fpRate float64, numShards uint32, newHash1 func() hash.Hash64, newHash2 func() hash.Hash64)
+//
+// Large bloom filters that do not fit in the CPU caches are much faster as a blocked bloom filter, which sets all
+// bits of an element inside a single 64-byte block, at the cost of a slightly larger bit array. Its blocks are
+// selected by the high bits of the hash values, so its default hash function is XXH64 rather than FNV:
+//
+//     bbf := NewBlockedByEstimates(numItems uint64, fpRate float64, hash1 hash.Hash64, hash2 hash.Hash64)
+//
+// Column bloom filters of Parquet files, which other Parquet implementations can read, are built with a split block
+// bloom filter, whose MarshalBinary returns the bitset in the layout of the Parquet format:
+//
+//     sbbf := NewSplitBlockByEstimates(numItems uint64, fpRate float64)
+//
+// All of the options of BloomFilter, BloomFilterTS and AtomicBloomFilter can also be given to New, which validates them
+// in one place and returns ErrConflictingOptions for options that exclude each other:
+//
+//     f, err := New(WithEstimates(numItems, fpRate), WithMemoryBudget(numBytes), WithSeed(seed), WithThreadSafety(Locked))
+//
+// Sizing can be planned before a bloom filter is created. PlanSize, PlanNumItems, PlanFPRate and PlanNumHashFunctions
+// each solve for one of the number of items, size, false positive rate and number of hash functions given the others,
+// with the formulas of NewByEstimates, and the resulting Plan reports memory in bytes and creates the bloom filter:
+//
+//     p, err := PlanFPRate(500000000, 8*256<<20, 0) // false positive rate of 500M items in 256 MiB
+//     bf, err := NewFromPlan(p, h)
+//
 // Once a bloom filter structure is created, one can add an element by;
 //
 //     bf.Add([]byte("data"))
@@ -63,6 +98,93 @@
 //
 //     exists := bf.Query([]byte("data"))
 //
+// Batches of elements are added and tested with AddMany and QueryMany, which lock a BloomFilterTS once per batch.
+// AddManyParallel and QueryManyParallel hash the batch with worker goroutines first and stop when ctx is done:
+//
+//     bfts.AddMany(batch [][]byte)
+//     results := bfts.QueryMany(batch [][]byte)
+//     err := bfts.AddManyParallel(ctx context.Context, batch [][]byte, workers int)
+//
+// Both structures implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler, so a bloom filter
+// can be saved and loaded later by;
+//
+//     data, err := bf.MarshalBinary()
+//     err = bf.UnmarshalBinary(data)
+//
+// Removing an element is possible with a counting bloom filter, which keeps a 4 or 8 bit counter
+// instead of a single bit at every location and therefore uses 4 or 8 times as much memory:
+//
+//     cbf := NewCountingByEstimates(numItems uint64, fpRate float64, counterWidth uint8, hash1 hash.Hash64, hash2 hash.Hash64)
+//     cbf.Add([]byte("data"))
+//     err := cbf.Remove([]byte("data"))
+//
+// For false positive rates below about 0.3%, a cuckoo filter takes less space than a bloom filter and
+// also supports deletion, although inserting into a nearly full cuckoo filter fails:
+//
+//     cf := NewCuckooByEstimates(numItems uint64, fpRate float64, bucketSize uint8, hash1 hash.Hash64, hash2 hash.Hash64)
+//     err := cf.Insert([]byte("data"))
+//     exists := cf.Lookup([]byte("data"))
+//     deleted := cf.Delete([]byte("data"))
+//
+// A set of keys that never changes is best kept in a binary fuse filter, which is built once from all of the keys
+// and takes about 9 bits per key with 8-bit fingerprints, or about 18 with 16-bit fingerprints, for a false positive
+// rate of about 1/256 or 1/65536:
+//
+//     bff, err := BuildBinaryFuse(keys [][]byte, fingerprintBits uint8)
+//     exists := bff.Query([]byte("data"))
+//
+// When the number of items is not known in advance, a scalable bloom filter adds new, larger bloom filters
+// as items are added and keeps the false positive rate below fpRate for any number of items:
+//
+//     sbf := NewScalable(numItems uint64, fpRate float64, growthFactor uint64, tighteningRatio float64, hash1 hash.Hash64, hash2 hash.Hash64)
+//
+// To only hold the elements that were added within a window of time, such as for deduplicating event streams,
+// a sliding window bloom filter keeps a ring of bloom filters that each cover granularity of time, and clears the
+// oldest one as time passes. now is the clock, which can be replaced in tests, and time.Now is used when it is nil:
+//
+//     swbf := NewSlidingWindow(numItems uint64, fpRate float64, 10*time.Minute, time.Minute, now func() time.Time, hash1 hash.Hash64, hash2 hash.Hash64)
+//
+// Unbounded streams saturate any bloom filter of a fixed size. A stable bloom filter decrements randomly chosen
+// cells on every Add, so that old elements are forgotten and the false positive rate stays at most fpRate forever,
+// at the cost of false negatives for old elements. src can be a rand.Source with a fixed seed for reproducible results:
+//
+//     stbf := NewStable(size uint64, fpRate float64, cellWidth uint8, src rand.Source, hash1 hash.Hash64, hash2 hash.Hash64)
+//
+// Large bloom filters can be streamed to and from files or network connections without holding
+// a second copy in memory, since both structures also implement io.WriterTo and io.ReaderFrom:
+//
+//     n, err := bf.WriteTo(w)
+//     bf, err := NewFromReader(r, hash1, hash2)
+//
+// A bloom filter can only be loaded with the same hash functions that it was built with.
+//
+// On Linux, a bloom filter file that is larger than memory can be mapped into memory instead of being read.
+// Its bits are backed by the page cache, which is shared by every process that maps the same file, and with
+// MapReadWrite, Add writes to the file and Sync updates its header and checksum. Opening a file only reads its header,
+// and Verify checks its checksum on demand. TryAdd and TryQuery return ErrFileTruncated instead of panicking
+// when another process truncates the file while it is mapped:
+//
+//     mbf, err := NewMapped(path string, MapReadOnly, hash1 hash.Hash64, hash2 hash.Hash64)
+//     defer mbf.Close()
+//
+// hash.Hash64 keeps state between calls, so a pair of them can only be used by one call at a time.
+// The constructors of BloomFilter, BloomFilterTS, AtomicBloomFilter and BlockedBloomFilter have variants that take
+// a stateless Hasher instead, which returns both hash values in a single call and may be used by any number
+// of goroutines at once:
+//
+//     bf := NewByEstimatesWithHasher(numItems uint64, fpRate float64, h Hasher)
+//
+// NewFNVHasher, NewXXHasher and the keyed NewSipHasher are built in, and NewHash64Hasher adapts a pair of hash.Hash64.
+//
+// Code that should work with any kind of bloom filter can take a Filter, which has Add and Query methods.
+// Filters that support more implement Remover, Merger, Counter or Serializer as well, which can be checked for by
+// a type assertion:
+//
+//     var f Filter = bf
+//     if s, ok := f.(Serializer); ok {
+//         data, err := s.MarshalBinary()
+//     }
+//
 package bloomfilter
 
 import (
@@ -74,11 +196,18 @@ import (
 
 // BloomFilter is non-thread safe bloom filter data structure.
 type BloomFilter struct {
-	hash1            hash.Hash64
-	hash2            hash.Hash64
+	hasher           Hasher
+	hashScheme       uint64
 	numHashFunctions uint8
 	size             uint64 //in bits
 	bits             []uint64
+	bitsSet          uint64
+	count            uint64 // number of Add calls
+	capacity         uint64 // estimated number of items
+
+	fpRateThreshold float64
+	onThreshold     func(Stats)
+	thresholdFired  bool
 }
 
 // BloomFilterTS is a BloomFilter structure with a RWMutex for thread safety.
@@ -89,25 +218,45 @@ type BloomFilterTS struct {
 
 // Add takes a byte slice as input and adds it to the BloomFilter structure's bit array.
 func (bf *BloomFilter) Add(data []byte) {
-	bitLocations := bf.getBitLocations(data)
+	if bf.add(data) {
+		bf.onThreshold(bf.Stats())
+	}
+}
+
+// add adds data to the bit array and reports whether the estimated false positive rate passed the threshold
+// set by SetFPRateThreshold with this call.
+// Each bit location is computed and set inline, so that no memory is allocated.
+func (bf *BloomFilter) add(data []byte) bool {
+	return bf.addHashes(bf.hasher.Sum128(data))
+}
 
-	for i := 0; i < len(bitLocations); i++ {
-		currLoc := bitLocations[i]
-		sliceLoc := (currLoc - (currLoc % 64)) / 64
-		bf.bits[sliceLoc] |= (1 << (currLoc % 64))
+// addHashes adds the element whose two hash values are hash1Val and hash2Val, as add does.
+func (bf *BloomFilter) addHashes(hash1Val uint64, hash2Val uint64) bool {
+	for i := uint8(0); i < bf.numHashFunctions; i++ {
+		currLoc := location(hash1Val, hash2Val, i, bf.size)
+		sliceLoc := currLoc / 64
+		if bf.bits[sliceLoc]&(1<<(currLoc%64)) == 0 {
+			bf.bits[sliceLoc] |= (1 << (currLoc % 64))
+			bf.bitsSet++
+		}
 	}
+	bf.count++
+
+	return bf.passedThreshold()
 }
 
 // Query tests the byte slice input's existence in the BloomFilter structure and returns a boolean value. 
 // The result is either true for existence or false for inexistence. 
 // However it should be noted that false positives are possible, while false negatives are not.
 func (bf *BloomFilter) Query(data []byte) bool {
-	bitLocations := bf.getBitLocations(data)
+	return bf.queryHashes(bf.hasher.Sum128(data))
+}
 
-	for i := 0; i < len(bitLocations); i++ {
-		currLoc := bitLocations[i]
-		sliceLoc := (currLoc - (currLoc % 64)) / 64
-		if bf.bits[sliceLoc]&(1<<(currLoc%64)) == 0 {
+// queryHashes tests the existence of the element whose two hash values are hash1Val and hash2Val, as Query does.
+func (bf *BloomFilter) queryHashes(hash1Val uint64, hash2Val uint64) bool {
+	for i := uint8(0); i < bf.numHashFunctions; i++ {
+		currLoc := location(hash1Val, hash2Val, i, bf.size)
+		if bf.bits[currLoc/64]&(1<<(currLoc%64)) == 0 {
 			return false
 		}
 	}
@@ -115,11 +264,22 @@ func (bf *BloomFilter) Query(data []byte) bool {
 }
 
 // Add for thread safe BloomFilterTS structure serves the same purpose as Add for BloomFilter structure.
-// Structure is locked for
+// Structure is locked for writing, and the function set by SetFPRateThreshold is called after it is unlocked.
 func (bfts *BloomFilterTS) Add(data []byte) {
 	bfts.mtx.Lock()
-	bfts.bf.Add(data)
+	bfts.unlockAfterAdd(bfts.bf.add(data))
+}
+
+// unlockAfterAdd unlocks the BloomFilterTS structure, which is locked for writing, and calls the function set by
+// SetFPRateThreshold afterwards when passed is true.
+func (bfts *BloomFilterTS) unlockAfterAdd(passed bool) {
+	if !passed {
+		bfts.mtx.Unlock()
+		return
+	}
+	onThreshold, stats := bfts.bf.onThreshold, bfts.bf.Stats()
 	bfts.mtx.Unlock()
+	onThreshold(stats)
 }
 
 // Query for thread safe BloomFilterTS structure serves the same purpose as Query for BloomFilter structure.
@@ -133,18 +293,12 @@ func (bfts *BloomFilterTS) Query(data []byte) bool {
 // NewByEstimates requires estimated number of items and estimated false positive rate to create a BloomFilter structure.
 // This function calculates size in bits and ideal number of hash functions that will be created by double hashing of 
 // hash function hash1 and hash function hash2.
+// Neither is clamped: ErrTooManyHashFunctions is returned when fpRate is so low that more than MaxHashFunctions
+// hash functions would be ideal, which is below about 2^-255, and ErrSizeOverflow is returned when the size would be
+// more than MaxSize bits.
 // hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
 func NewByEstimates(numItems uint64, fpRate float64, hash1 hash.Hash64, hash2 hash.Hash64) (*BloomFilter, error) {
-	if numItems == 0 {
-		return nil, ErrInvalidNumberOfItems 
-	}
-	if fpRate >= 1.0 || fpRate <= 0.0 {
-		return nil, ErrInvalidFalsePositiveRate
-	}
-	size := uint64(math.Ceil(-1 * float64(numItems) * math.Log(fpRate) / math.Pow(math.Log(2), 2)))
-	numHashFunctions := uint8(math.Ceil(math.Log(2) * float64(size) / float64(numItems)))
-	
-	return NewBySizeAndNumHashFuncs(size, numHashFunctions, hash1, hash2)
+	return NewByEstimatesWithHasher(numItems, fpRate, hasherOf(hash1, hash2))
 }
 
 func defaultHash1() hash.Hash64 {
@@ -156,56 +310,54 @@ func defaultHash2() hash.Hash64 {
 }
 
 // NewBySizeAndNumHashFuncs requires maximum size in bits and number of hash functions that will be created via double hashing of
-// hash function hash1 and hash function hash2.
+// hash function hash1 and hash function hash2. ErrSizeOverflow is returned when size is more than MaxSize.
 // hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+// When both are nil, hashing keeps no state at all. Otherwise hash1 and hash2 keep state between calls, so they are
+// used by one Add or Query at a time, and they must not be used anywhere else afterwards.
 // This function returns a new BloomFilter structure.
 func NewBySizeAndNumHashFuncs(size uint64, numHashFunctions uint8, hash1 hash.Hash64, hash2 hash.Hash64) (*BloomFilter, error) {
-	if size == 0 {
-		return nil, ErrInvalidSize
-	}
-	if numHashFunctions == 0 {
-		return nil, ErrInvalidNumberOfHashFunctions
-	}
-	if hash1 == nil {
-		hash1 = defaultHash1()
-	}
+	return NewBySizeAndNumHashFuncsWithHasher(size, numHashFunctions, hasherOf(hash1, hash2))
+}
 
-	if hash2 == nil {
-		hash2 = defaultHash2()
-	}
+// NewByEstimatesWithHasher returns a new BloomFilter structure for estimated number of items and estimated false positive rate,
+// whose locations are created by double hashing of the two hash values of h.
+// For more details, please see NewByEstimates function. h can be nil and when it is nil, the Hasher returned by
+// NewFNVHasher will be used.
+func NewByEstimatesWithHasher(numItems uint64, fpRate float64, h Hasher) (*BloomFilter, error) {
+	o := newOptions(WithEstimates(numItems, fpRate), WithHasher(h))
+	return o.build()
+}
 
-	l := (size - (size % 64)) / 64
+// NewBySizeAndNumHashFuncsWithHasher returns a new BloomFilter structure for maximum size in bits and number of hash functions
+// that will be created via double hashing of the two hash values of h.
+// For more details, please see NewBySizeAndNumHashFuncs function. h can be nil and when it is nil, the Hasher returned by
+// NewFNVHasher will be used.
+func NewBySizeAndNumHashFuncsWithHasher(size uint64, numHashFunctions uint8, h Hasher) (*BloomFilter, error) {
+	o := newOptions(WithSize(size, numHashFunctions), WithHasher(h))
+	return o.build()
+}
 
-	if size%64 > 0 {
-		l++
-	}
+// newBloomFilter returns a new BloomFilter structure without validating its parameters.
+func newBloomFilter(size uint64, numHashFunctions uint8, h Hasher) *BloomFilter {
+	l := numWords(size)
 
 	bits := make([]uint64, l, l)
 
 	bf := BloomFilter{
-		hash1:            hash1,
-		hash2:            hash2,
+		hasher:           h,
+		hashScheme:       hashScheme(h),
 		numHashFunctions: numHashFunctions,
 		size:             size,
 		bits:             bits,
+		capacity:         capacityOf(size, numHashFunctions),
 	}
 
-	return &bf, nil
+	return &bf
 }
 
 // NewTSByEstimates returns a new BloomFilterTS structure. For more details, please see NewByEstimates function.
 func NewTSByEstimates(numItems uint64, fpRate float64, hash1 hash.Hash64, hash2 hash.Hash64) (*BloomFilterTS, error) {
-	if numItems == 0 {
-		return nil, ErrInvalidNumberOfItems 
-	}
-	if fpRate >= 1.0 || fpRate <= 0.0 {
-		return nil, ErrInvalidFalsePositiveRate
-	}
-	
-	size := uint64(math.Ceil(-1 * float64(numItems) * math.Log(fpRate) / math.Pow(math.Log(2), 2)))
-	numHashFunctions := uint8(math.Ceil(math.Log(2) * float64(size) / float64(numItems)))
-
-	bf, err := NewBySizeAndNumHashFuncs(size, numHashFunctions, hash1, hash2)
+	bf, err := NewByEstimates(numItems, fpRate, hash1, hash2)
 	if err != nil {
 		return nil, err
 	}
@@ -223,19 +375,87 @@ func NewTSBySizeAndNumHashFuncs(size uint64, numHashFunctions uint8, hash1 hash.
 	return &BloomFilterTS{bf: bf}, nil
 }
 
-func (bf *BloomFilter) getBitLocations(data []byte) []uint64 {
-	bf.hash1.Reset()
-	bf.hash1.Write(data)
-	bf.hash2.Reset()
-	bf.hash2.Write(data)
-	hash1Val := bf.hash1.Sum64()
-	hash2Val := bf.hash2.Sum64()
+// NewTSByEstimatesWithHasher returns a new BloomFilterTS structure. For more details, please see NewByEstimatesWithHasher function.
+func NewTSByEstimatesWithHasher(numItems uint64, fpRate float64, h Hasher) (*BloomFilterTS, error) {
+	bf, err := NewByEstimatesWithHasher(numItems, fpRate, h)
+	if err != nil {
+		return nil, err
+	}
 
-	retVal := make([]uint64, bf.numHashFunctions)
+	return &BloomFilterTS{bf: bf}, nil
+}
 
-	for i := uint8(0); i < bf.numHashFunctions; i++ {
-		retVal[i] = (hash1Val + uint64(i)*hash2Val) % (bf.size)
+// NewTSBySizeAndNumHashFuncsWithHasher returns a new BloomFilterTS structure.
+// For more details, please see NewBySizeAndNumHashFuncsWithHasher function.
+func NewTSBySizeAndNumHashFuncsWithHasher(size uint64, numHashFunctions uint8, h Hasher) (*BloomFilterTS, error) {
+	bf, err := NewBySizeAndNumHashFuncsWithHasher(size, numHashFunctions, h)
+	if err != nil {
+		return nil, err
 	}
 
-	return retVal
+	return &BloomFilterTS{bf: bf}, nil
+}
+
+// numWords returns the number of uint64 words required to hold size bits.
+func numWords(size uint64) uint64 {
+	l := (size - (size % 64)) / 64
+
+	if size%64 > 0 {
+		l++
+	}
+
+	return l
+}
+
+const (
+	// MaxHashFunctions is the largest number of hash functions of a bloom filter.
+	MaxHashFunctions = math.MaxUint8
+
+	// MaxSize is the largest size of a bloom filter in bits, which leaves room for rounding it up
+	// to whole words and blocks without overflowing uint64.
+	MaxSize = 1 << 63
+)
+
+// estimates returns the size in bits and the ideal number of hash functions of a bloom filter
+// that holds numItems items with a false positive rate of fpRate.
+// Neither is clamped: ErrSizeOverflow is returned when the size would be larger than MaxSize, and ErrTooManyHashFunctions
+// when the ideal number of hash functions would be larger than MaxHashFunctions, which happens for false positive rates
+// below about 2^-255. The ideal number of hash functions is -log2(fpRate) rounded up and does not depend on numItems.
+func estimates(numItems uint64, fpRate float64) (uint64, uint8, error) {
+	size := math.Ceil(-1 * float64(numItems) * math.Log(fpRate) / math.Pow(math.Log(2), 2))
+	if !(size <= MaxSize) {
+		return 0, 0, ErrSizeOverflow
+	}
+	numHashFunctions := math.Ceil(math.Log(2) * size / float64(numItems))
+	if numHashFunctions > MaxHashFunctions {
+		return 0, 0, ErrTooManyHashFunctions
+	}
+
+	return uint64(size), uint8(numHashFunctions), nil
+}
+
+// clampedEstimates returns the size in bits and the number of hash functions of a bloom filter as estimates does,
+// for bloom filters that must be created anyway, such as the layers of a ScalableBloomFilter.
+// Instead of returning ErrTooManyHashFunctions, the number of hash functions is clamped to MaxHashFunctions and the size
+// grows so that the false positive rate is still fpRate, which takes less than 1 percent more bits down to
+// a false positive rate of 1e-80, and about 50 percent more at 1e-200.
+// Instead of returning ErrSizeOverflow, the size is clamped to MaxSize and the false positive rate is higher than fpRate.
+func clampedEstimates(numItems uint64, fpRate float64) (uint64, uint8) {
+	size, numHashFunctions, err := estimates(numItems, fpRate)
+	switch err {
+	case nil:
+		return size, numHashFunctions
+	case ErrTooManyHashFunctions:
+		if s := sizeFor(numItems, MaxHashFunctions, fpRate); s <= MaxSize {
+			return uint64(s), MaxHashFunctions
+		}
+	}
+
+	k := idealNumHashFunctions(MaxSize, numItems)
+	return MaxSize, k
+}
+
+// location returns the i-th location in range [0, size) of an element, created by double hashing of its two hash values.
+func location(hash1Val uint64, hash2Val uint64, i uint8, size uint64) uint64 {
+	return (hash1Val + uint64(i)*hash2Val) % size
 }
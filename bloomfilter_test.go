@@ -2,8 +2,12 @@ package bloomfilter
 
 import (
 	"fmt"
-	"testing"
+	"hash"
+	"hash/fnv"
+	"math"
 	"math/rand"
+	"sync"
+	"testing"
 	"time"
 )
 
@@ -38,6 +42,7 @@ func TestBloomFilterInit(t *testing.T) {
 		{uint64(100), 1.0},
 		{uint64(1000), -0.1},
 		{uint64(1000), 1.1},
+		{uint64(1000), math.NaN()},
 		{uint64(1), 0.1},
 		{uint64(1), 0.01},
 		{uint64(1), 0.001},
@@ -75,7 +80,7 @@ func TestBloomFilterInit(t *testing.T) {
 				t.Logf("expected error message for values of numItems %v, fpRate %v is %v", testsForEstimates[i].numItems, testsForEstimates[i].fpRate, ErrInvalidNumberOfItems.Error())
 				t.Fail()
 			}
-		} else if testsForEstimates[i].fpRate <= 0.0 || testsForEstimates[i].fpRate >= 1.0 {
+		} else if !(testsForEstimates[i].fpRate > 0.0 && testsForEstimates[i].fpRate < 1.0) {
 			if bf != nil {
 				t.Logf("expected nil bloomfilter for values of numItems %v, fpRate %v", testsForEstimates[i].numItems, testsForEstimates[i].fpRate)
 				t.Fail()
@@ -137,7 +142,7 @@ func TestBloomFilterInit(t *testing.T) {
 				t.Logf("expected error message for values of numItems %v, fpRate %v is %v", testsForEstimates[i].numItems, testsForEstimates[i].fpRate, ErrInvalidNumberOfItems.Error())
 				t.Fail()
 			}
-		} else if testsForEstimates[i].fpRate <= 0.0 || testsForEstimates[i].fpRate >= 1.0 {
+		} else if !(testsForEstimates[i].fpRate > 0.0 && testsForEstimates[i].fpRate < 1.0) {
 			if bfts != nil {
 				t.Logf("expected nil bloomfilter for values of numItems %v, fpRate %v", testsForEstimates[i].numItems, testsForEstimates[i].fpRate)
 				t.Fail()
@@ -189,6 +194,94 @@ func TestBloomFilterInit(t *testing.T) {
 		}
 	}
 }
+
+func TestEstimates(t *testing.T) {
+	tests := []struct {
+		numItems         uint64
+		fpRate           float64
+		size             uint64
+		numHashFunctions uint8
+		err              error
+	}{
+		{1000, 0.01, 9586, 7, nil},
+		{1000, 1e-76, 364233, 253, nil},
+		{1, math.Pow(2, -254), 367, MaxHashFunctions, nil},
+		{1, math.Pow(2, -255), 0, 0, ErrTooManyHashFunctions},
+		{1000, 1e-77, 0, 0, ErrTooManyHashFunctions},
+		{1000, 1e-80, 0, 0, ErrTooManyHashFunctions},
+		{1000, math.SmallestNonzeroFloat64, 0, 0, ErrTooManyHashFunctions},
+		{1 << 62, 0.5, 6653256548922161152, 1, nil},
+		{1 << 63, 0.5, 0, 0, ErrSizeOverflow},
+		{math.MaxUint64, 0.01, 0, 0, ErrSizeOverflow},
+	}
+
+	for _, tt := range tests {
+		size, numHashFunctions, err := estimates(tt.numItems, tt.fpRate)
+		if size != tt.size || numHashFunctions != tt.numHashFunctions || err != tt.err {
+			t.Errorf("estimates(%v, %v): expected %v, %v and %v, actual %v, %v and %v",
+				tt.numItems, tt.fpRate, tt.size, tt.numHashFunctions, tt.err, size, numHashFunctions, err)
+		}
+	}
+}
+
+func TestClampedEstimates(t *testing.T) {
+	tests := []struct {
+		numItems uint64
+		fpRate   float64
+	}{
+		{1, math.Pow(2, -255)},
+		{1000, 1e-80},
+		{1000, 1e-200},
+	}
+
+	for _, tt := range tests {
+		size, numHashFunctions := clampedEstimates(tt.numItems, tt.fpRate)
+		if numHashFunctions != MaxHashFunctions {
+			t.Errorf("clampedEstimates(%v, %v): expected %v hash functions, actual %v", tt.numItems, tt.fpRate, MaxHashFunctions, numHashFunctions)
+		}
+		ideal := -1 * float64(tt.numItems) * math.Log(tt.fpRate) / math.Pow(math.Log(2), 2)
+		if float64(size) < ideal {
+			t.Errorf("clampedEstimates(%v, %v): expected at least %v bits, actual %v", tt.numItems, tt.fpRate, ideal, size)
+		}
+		k := float64(numHashFunctions)
+		if fp := math.Exp(k * math.Log(-math.Expm1(-k*float64(tt.numItems)/float64(size)))); fp > tt.fpRate*(1+1e-9) {
+			t.Errorf("clampedEstimates(%v, %v): expected false positive rate at most %v, actual %v", tt.numItems, tt.fpRate, tt.fpRate, fp)
+		}
+	}
+
+	if size, numHashFunctions := clampedEstimates(math.MaxUint64, 0.01); size != MaxSize || numHashFunctions != 1 {
+		t.Errorf("clampedEstimates(%v, %v): expected %v and %v, actual %v and %v", uint64(math.MaxUint64), 0.01, uint64(MaxSize), 1, size, numHashFunctions)
+	}
+}
+
+// Every constructor that sizes by estimates must return the errors of estimates rather than wrap around.
+func TestEstimatesErrors(t *testing.T) {
+	tests := []struct {
+		description string
+		newFilter   func() (interface{}, error)
+		err         error
+	}{
+		{"NewByEstimates", func() (interface{}, error) { return NewByEstimates(1000, 1e-80, nil, nil) }, ErrTooManyHashFunctions},
+		{"NewByEstimates", func() (interface{}, error) { return NewByEstimates(math.MaxUint64, 0.01, nil, nil) }, ErrSizeOverflow},
+		{"NewTSByEstimates", func() (interface{}, error) { return NewTSByEstimates(1000, 1e-80, nil, nil) }, ErrTooManyHashFunctions},
+		{"NewAtomicByEstimates", func() (interface{}, error) { return NewAtomicByEstimates(math.MaxUint64, 0.01, nil, nil) }, ErrSizeOverflow},
+		{"NewCountingByEstimates", func() (interface{}, error) { return NewCountingByEstimates(1000, 1e-80, 4, nil, nil) }, ErrTooManyHashFunctions},
+		{"NewBlockedByEstimates", func() (interface{}, error) { return NewBlockedByEstimates(1000, 1e-80, nil, nil) }, ErrTooManyHashFunctions},
+		{"NewBlockedByEstimates", func() (interface{}, error) { return NewBlockedByEstimates(math.MaxUint64, 0.01, nil, nil) }, ErrSizeOverflow},
+		{"NewScalable", func() (interface{}, error) { return NewScalable(1000, 1e-77, 0, 0, nil, nil) }, ErrTooManyHashFunctions},
+		{"NewBySizeAndNumHashFuncs", func() (interface{}, error) { return NewBySizeAndNumHashFuncs(MaxSize+1, 3, nil, nil) }, ErrSizeOverflow},
+		{"NewBlockedBySizeAndNumHashFuncs", func() (interface{}, error) { return NewBlockedBySizeAndNumHashFuncs(math.MaxUint64, 3, nil, nil) }, ErrSizeOverflow},
+		{"NewCountingBySizeAndNumHashFuncs", func() (interface{}, error) { return NewCountingBySizeAndNumHashFuncs(MaxSize+1, 3, 4, nil, nil) }, ErrSizeOverflow},
+		{"New", func() (interface{}, error) { return New(WithSize(MaxSize+1, 3)) }, ErrSizeOverflow},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.newFilter(); err != tt.err {
+			t.Errorf("%v: expected error %v, actual %v", tt.description, tt.err, err)
+		}
+	}
+}
+
 func TestBloomFilterBasics(t *testing.T) {
 	var (
 		count = 1000000
@@ -313,6 +406,46 @@ func TestBloomFilterTSParallel(t *testing.T) {
 	}
 }
 
+// This test should NOT fail when "go test -race" command is issued.
+// Concurrent queries of BloomFilterTS structure only take a read lock, so hashing must not share any state.
+func TestBloomFilterTSQueryParallel(t *testing.T) {
+	var (
+		count = 10000
+		numItems = uint64(count)
+		fp = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+		goroutines = 8
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	for _, hash1 := range []hash.Hash64{nil, fnv.New64a()} {
+		bf, err := NewTSByEstimates(numItems, fp, hash1, nil)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		for _, tt := range tests {
+			bf.Add(tt.data)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := g; i < count; i += goroutines {
+					if result := bf.Query(tests[i].data); !result {
+						t.Errorf("Query(%v): expected %v, actual %v", string(tests[i].data), true, false)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+	}
+}
+
 // Some of the following tests may fail even when an additional acceptable false positive rate is provided
 func TestFalsePositiveRate1000_5(t *testing.T)   { testFalsePositiveRate(t, 1000, 0.5) }
 func TestFalsePositiveRate10000_5(t *testing.T)   { testFalsePositiveRate(t, 10000, 0.5) }
@@ -354,6 +487,7 @@ func BenchmarkAdd(t *testing.B) {
 
 	tests := prepTestCases(count, minStrLen, maxStrLen)
 
+	t.ReportAllocs()
 	t.ResetTimer()
 
 	for _, tt := range tests {
@@ -379,6 +513,7 @@ func BenchmarkQueryEmptyBF(t *testing.B) {
 
 	tests := prepTestCases(count, minStrLen, maxStrLen)
 
+	t.ReportAllocs()
 	t.ResetTimer()
 	for _, tt := range tests {
 		bf.Query(tt.data)
@@ -406,6 +541,7 @@ func BenchmarkQuery(t *testing.B) {
 		bf.Add(tt.data)
 	}
 	
+	t.ReportAllocs()
 	t.ResetTimer()
 
 	for _, tt := range tests {
@@ -414,6 +550,78 @@ func BenchmarkQuery(t *testing.B) {
 	
 }
 
+// Add and Query must not allocate, whichever hash functions are used.
+func TestAddQueryAllocs(t *testing.T) {
+	data := []byte("data")
+	hashers := []struct {
+		description string
+		h           Hasher
+	}{
+		{"FNV", NewFNVHasher()},
+		{"XX", NewXXHasher(0)},
+		{"Sip", NewSipHasher(0, 0)},
+		{"Hash64", NewHash64Hasher(fnv.New64a(), fnv.New64())},
+	}
+	for _, hh := range hashers {
+		bf, err := NewBySizeAndNumHashFuncsWithHasher(1000, 7, hh.h)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if allocs := testing.AllocsPerRun(100, func() { bf.Add(data) }); allocs != 0 {
+			t.Errorf("%v: Add: expected 0 allocations, actual %v", hh.description, allocs)
+		}
+		if allocs := testing.AllocsPerRun(100, func() { bf.Query(data) }); allocs != 0 {
+			t.Errorf("%v: Query: expected 0 allocations, actual %v", hh.description, allocs)
+		}
+	}
+}
+
+// benchmarkOp runs fn for b.N elements of a bloom filter that holds 1000000 items, so that ns/op and allocs/op
+// are reported per Add or Query call.
+func benchmarkOp(b *testing.B, h Hasher, fn func(bf *BloomFilter, data []byte)) {
+	var (
+		count     = 1000000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	bf, err := NewByEstimatesWithHasher(numItems, fp, h)
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	for _, tt := range tests {
+		bf.Add(tt.data)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn(bf, tests[i%count].data)
+	}
+}
+
+func BenchmarkAddOp(b *testing.B) {
+	benchmarkOp(b, nil, func(bf *BloomFilter, data []byte) { bf.Add(data) })
+}
+
+func BenchmarkQueryOp(b *testing.B) {
+	benchmarkOp(b, nil, func(bf *BloomFilter, data []byte) { bf.Query(data) })
+}
+
+func BenchmarkAddOpXX(b *testing.B) {
+	benchmarkOp(b, NewXXHasher(0), func(bf *BloomFilter, data []byte) { bf.Add(data) })
+}
+
+func BenchmarkQueryOpXX(b *testing.B) {
+	benchmarkOp(b, NewXXHasher(0), func(bf *BloomFilter, data []byte) { bf.Query(data) })
+}
+
 func testFalsePositiveRate(t *testing.T, count int, fp float64) {
 	var (
 		numItems = uint64(count)
@@ -0,0 +1,107 @@
+package bloomfilter
+
+import (
+	"math"
+	"math/bits"
+)
+
+// popcount returns the number of bits that are set in the bit array of the BloomFilter structure.
+func (bf *BloomFilter) popcount() uint64 {
+	var c uint64
+	for _, w := range bf.bits {
+		c += uint64(bits.OnesCount64(w))
+	}
+	return c
+}
+
+// estimateCount returns the estimated number of distinct elements that were added to a bloom filter of
+// size bits and numHashFunctions hash functions, bitsSet bits of which are set, as given by Swamidass and Baldi
+// in "Mathematical correction for fingerprint similarity measures to improve chemical retrieval".
+func estimateCount(size uint64, numHashFunctions uint8, bitsSet uint64) float64 {
+	if bitsSet >= size {
+		return math.Inf(1)
+	}
+	m, k := float64(size), float64(numHashFunctions)
+	return -m / k * math.Log1p(-float64(bitsSet)/m)
+}
+
+// roundCount rounds an estimated number of elements to the nearest uint64.
+// Negative estimates are rounded to 0 and estimates that do not fit are rounded to math.MaxUint64.
+func roundCount(n float64) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	if n >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(math.Round(n))
+}
+
+// EstimatedCount returns the approximate number of distinct elements that were added to the BloomFilter structure,
+// calculated from the number of bits that are set.
+// When every bit is set, the number of elements can not be estimated and math.MaxUint64 is returned.
+func (bf *BloomFilter) EstimatedCount() uint64 {
+	return roundCount(estimateCount(bf.size, bf.numHashFunctions, bf.bitsSet))
+}
+
+// estimatedUnionCount returns the estimated number of distinct elements that were added to either bf or other.
+func (bf *BloomFilter) estimatedUnionCount(other *BloomFilter) float64 {
+	var c uint64
+	for i := range bf.bits {
+		c += uint64(bits.OnesCount64(bf.bits[i] | other.bits[i]))
+	}
+	return estimateCount(bf.size, bf.numHashFunctions, c)
+}
+
+// EstimatedUnionCount returns the approximate number of distinct elements that were added to either the BloomFilter
+// structure or other, without building their union.
+// ErrIncompatibleFilters is returned when the two BloomFilter structures differ in size, number of hash functions
+// or hash functions.
+func (bf *BloomFilter) EstimatedUnionCount(other *BloomFilter) (uint64, error) {
+	if !bf.compatible(other) {
+		return 0, ErrIncompatibleFilters
+	}
+	return roundCount(bf.estimatedUnionCount(other)), nil
+}
+
+// EstimatedIntersectionCount returns the approximate number of distinct elements that were added to both the BloomFilter
+// structure and other, calculated by the inclusion-exclusion principle as n(A) + n(B) - n(A ∪ B).
+// This is more accurate than the estimated count of an intersection made by Intersect, whose bit array
+// also holds bits that were set by different elements in each BloomFilter structure.
+// ErrIncompatibleFilters is returned when the two BloomFilter structures differ in size, number of hash functions
+// or hash functions.
+func (bf *BloomFilter) EstimatedIntersectionCount(other *BloomFilter) (uint64, error) {
+	if !bf.compatible(other) {
+		return 0, ErrIncompatibleFilters
+	}
+	n := estimateCount(bf.size, bf.numHashFunctions, bf.bitsSet) +
+		estimateCount(other.size, other.numHashFunctions, other.bitsSet) -
+		bf.estimatedUnionCount(other)
+	if math.IsNaN(n) {
+		// every bit of the union is set
+		return math.MaxUint64, nil
+	}
+	return roundCount(n), nil
+}
+
+// EstimatedCount for thread safe BloomFilterTS structure serves the same purpose as EstimatedCount for BloomFilter structure.
+func (bfts *BloomFilterTS) EstimatedCount() uint64 {
+	bfts.mtx.RLock()
+	defer bfts.mtx.RUnlock()
+	return bfts.bf.EstimatedCount()
+}
+
+// EstimatedUnionCount for thread safe BloomFilterTS structure serves the same purpose as EstimatedUnionCount for BloomFilter structure.
+func (bfts *BloomFilterTS) EstimatedUnionCount(other *BloomFilterTS) (uint64, error) {
+	unlock := lockPair(bfts, other, false)
+	defer unlock()
+	return bfts.bf.EstimatedUnionCount(other.bf)
+}
+
+// EstimatedIntersectionCount for thread safe BloomFilterTS structure serves the same purpose as EstimatedIntersectionCount
+// for BloomFilter structure.
+func (bfts *BloomFilterTS) EstimatedIntersectionCount(other *BloomFilterTS) (uint64, error) {
+	unlock := lockPair(bfts, other, false)
+	defer unlock()
+	return bfts.bf.EstimatedIntersectionCount(other.bf)
+}
@@ -0,0 +1,116 @@
+package bloomfilter
+
+import (
+	"hash/crc64"
+	"math"
+	"testing"
+)
+
+const acceptableCountError float64 = 0.05
+
+// FNV-1 and FNV-1a are too similar for the bits that an element sets to be independent,
+// which biases the estimates, so a CRC-64 is used as the second hash function.
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+func TestBloomFilterEstimatedCount(t *testing.T) {
+	var (
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	for _, count := range []int{1000, 10000, 100000} {
+		bf, err := NewByEstimates(uint64(count), 0.01, nil, crc64.New(crc64Table))
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if c := bf.EstimatedCount(); c != 0 {
+			t.Errorf("expected estimated count of an empty bloom filter to be 0, actual %v", c)
+		}
+
+		for _, tt := range prepTestCases(count, minStrLen, maxStrLen) {
+			bf.Add(tt.data)
+			// adding the same element again must not change the estimate
+			bf.Add(tt.data)
+		}
+		if c := bf.EstimatedCount(); math.Abs(float64(c)-float64(count)) > acceptableCountError*float64(count) {
+			t.Errorf("expected estimated count to be about %v, actual %v", count, c)
+		}
+	}
+
+	bf, err := NewBySizeAndNumHashFuncs(64, 1, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for i := range bf.bits {
+		bf.bits[i] = math.MaxUint64
+	}
+	bf.bitsSet = bf.popcount()
+	if c := bf.EstimatedCount(); c != math.MaxUint64 {
+		t.Errorf("expected estimated count of a full bloom filter to be %v, actual %v", uint64(math.MaxUint64), c)
+	}
+}
+
+func TestBloomFilterEstimatedUnionAndIntersectionCount(t *testing.T) {
+	var (
+		count       = 20000
+		commonCount = 5000
+		maxStrLen   = 50
+		minStrLen   = 20
+	)
+
+	a, err := NewTSByEstimates(uint64(2*count), 0.001, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	b, err := NewTSByEstimates(uint64(2*count), 0.001, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range prepTestCases(count, minStrLen, maxStrLen) {
+		a.Add(tt.data)
+	}
+	for _, tt := range prepTestCases(count, minStrLen, maxStrLen) {
+		b.Add(tt.data)
+	}
+	for _, tt := range prepTestCases(commonCount, minStrLen, maxStrLen) {
+		a.Add(tt.data)
+		b.Add(tt.data)
+	}
+
+	union, err := a.EstimatedUnionCount(b)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	expected := float64(2*count + commonCount)
+	if math.Abs(float64(union)-expected) > acceptableCountError*expected {
+		t.Errorf("expected estimated union count to be about %v, actual %v", expected, union)
+	}
+
+	intersection, err := a.EstimatedIntersectionCount(b)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	// the intersection is a small difference of large estimates, so its error is larger
+	expected = float64(commonCount)
+	if math.Abs(float64(intersection)-expected) > 4*acceptableCountError*expected {
+		t.Errorf("expected estimated intersection count to be about %v, actual %v", expected, intersection)
+	}
+
+	other, err := NewTSByEstimates(uint64(count), 0.001, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if _, err := a.EstimatedUnionCount(other); err != ErrIncompatibleFilters {
+		t.Errorf("expected error %v, actual %v", ErrIncompatibleFilters, err)
+	}
+	if _, err := a.EstimatedIntersectionCount(other); err != ErrIncompatibleFilters {
+		t.Errorf("expected error %v, actual %v", ErrIncompatibleFilters, err)
+	}
+}
@@ -0,0 +1,355 @@
+// Command bloomfilter builds, queries, inspects and merges bloom filter files.
+//
+// Usage:
+//
+//	bloomfilter build [-n numItems] [-p fpRate] [-o file] [keyfile ...]
+//	bloomfilter query -f file [-q] [key ...]
+//	bloomfilter info file
+//	bloomfilter merge [-o file] file file ...
+//
+// Keys are read one per line from the key files, or from standard input when none are given or a file is "-".
+// Empty lines are skipped and a trailing carriage return is removed. build and merge write the filter to -o,
+// or to standard output when it is not given. query tests the keys given as arguments, or the keys read from
+// standard input when none are given, and prints each key followed by a tab and true or false unless -q is set.
+//
+// Filters are created by NewByEstimates with the default hash functions, and only such filters can be read.
+// Only filters of the same size can be merged, so filters that will be merged must be built with the same -n and -p.
+//
+// The exit status is 0 when every queried key is present, 1 when query finds a key that is not present,
+// and 2 on any error, so query can be used as a condition in shell scripts.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mraufc/bloomfilter"
+)
+
+const (
+	exitOK    = 0
+	exitMiss  = 1
+	exitError = 2
+
+	// maxKeyLen is the length of the longest line that is read as a key.
+	maxKeyLen = 1 << 20
+)
+
+// errUsage is returned for invalid arguments, after the usage has been printed.
+var errUsage = errors.New("invalid arguments")
+
+const usage = `usage:
+  bloomfilter build [-n numItems] [-p fpRate] [-o file] [keyfile ...]
+  bloomfilter query -f file [-q] [key ...]
+  bloomfilter info file
+  bloomfilter merge [-o file] file file ...
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command given by args and returns its exit status.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+
+	var (
+		miss bool
+		err  error
+	)
+	switch args[0] {
+	case "build":
+		err = build(args[1:], stdin, stdout, stderr)
+	case "query":
+		miss, err = query(args[1:], stdin, stdout, stderr)
+	case "info":
+		err = info(args[1:], stdout, stderr)
+	case "merge":
+		err = merge(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "bloomfilter: unknown command %q\n%v", args[0], usage)
+		return exitError
+	}
+
+	switch {
+	case err == errUsage:
+		return exitError
+	case err != nil:
+		fmt.Fprintf(stderr, "bloomfilter %v: %v\n", args[0], err)
+		return exitError
+	case miss:
+		return exitMiss
+	}
+	return exitOK
+}
+
+// newFlagSet returns a flag set for command name that prints its errors and usage to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parse parses args with fs, and returns errUsage when they are invalid.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// build reads keys and writes a bloom filter that holds them.
+// When -n is not given, the keys are held in memory and the bloom filter is sized for their number.
+func build(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("build", stderr)
+	numItems := fs.Uint64("n", 0, "estimated number of items, the number of keys read when 0")
+	fpRate := fs.Float64("p", 0.01, "estimated false positive rate")
+	output := fs.String("o", "", "output file, standard output when empty")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	var bf *bloomfilter.BloomFilter
+	if *numItems > 0 {
+		var err error
+		if bf, err = bloomfilter.NewByEstimates(*numItems, *fpRate, nil, nil); err != nil {
+			return err
+		}
+		if err := readKeys(fs.Args(), stdin, func(key []byte) { bf.Add(key) }); err != nil {
+			return err
+		}
+	} else {
+		var keys []string
+		if err := readKeys(fs.Args(), stdin, func(key []byte) { keys = append(keys, string(key)) }); err != nil {
+			return err
+		}
+		n := uint64(len(keys))
+		if n == 0 {
+			n = 1
+		}
+		var err error
+		if bf, err = bloomfilter.NewByEstimates(n, *fpRate, nil, nil); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			bf.Add([]byte(key))
+		}
+	}
+
+	return writeFilter(*output, bf, stdout)
+}
+
+// query tests keys against a bloom filter file and reports whether any of them is missing.
+func query(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (bool, error) {
+	fs := newFlagSet("query", stderr)
+	file := fs.String("f", "", "bloom filter file")
+	quiet := fs.Bool("q", false, "print nothing, only set the exit status")
+	if err := parse(fs, args); err != nil {
+		return false, err
+	}
+	if *file == "" {
+		fmt.Fprintln(stderr, "bloomfilter query: -f is required")
+		fs.Usage()
+		return false, errUsage
+	}
+
+	bf, err := readFilter(*file)
+	if err != nil {
+		return false, err
+	}
+
+	w := bufio.NewWriter(stdout)
+	miss := false
+	test := func(key []byte) {
+		exists := bf.Query(key)
+		miss = miss || !exists
+		if !*quiet {
+			fmt.Fprintf(w, "%s\t%v\n", key, exists)
+		}
+	}
+	if fs.NArg() > 0 {
+		for _, key := range fs.Args() {
+			test([]byte(key))
+		}
+	} else if err := readKeys(nil, stdin, test); err != nil {
+		return false, err
+	}
+
+	return miss, w.Flush()
+}
+
+// info prints the statistics of a bloom filter file.
+func info(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("info", stderr)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "bloomfilter info: exactly one file is required")
+		return errUsage
+	}
+
+	bf, err := readFilter(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	stats := bf.Stats()
+
+	w := bufio.NewWriter(stdout)
+	fmt.Fprintf(w, "size:               %v bits (%v bytes)\n", stats.Size, (stats.Size+63)/64*8)
+	fmt.Fprintf(w, "hash functions:     %v\n", stats.NumHashFunctions)
+	fmt.Fprintf(w, "bits set:           %v\n", stats.BitsSet)
+	fmt.Fprintf(w, "fill ratio:         %.6f\n", stats.FillRatio)
+	fmt.Fprintf(w, "estimated fp rate:  %.6g\n", stats.EstimatedFPRate)
+	fmt.Fprintf(w, "count:              %v\n", stats.Count)
+	fmt.Fprintf(w, "estimated count:    %v\n", bf.EstimatedCount())
+	fmt.Fprintf(w, "capacity:           %v\n", stats.Capacity)
+	return w.Flush()
+}
+
+// merge writes the union of two or more bloom filter files.
+func merge(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := newFlagSet("merge", stderr)
+	output := fs.String("o", "", "output file, standard output when empty")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintln(stderr, "bloomfilter merge: at least two files are required")
+		return errUsage
+	}
+
+	bf, err := readFilter(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, file := range fs.Args()[1:] {
+		other, err := readFilter(file)
+		if err != nil {
+			return err
+		}
+		if err := bf.Union(other); err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+	}
+
+	return writeFilter(*output, bf, stdout)
+}
+
+// readKeys calls fn with every key of files, or of stdin when there are no files or a file is "-".
+// The slice passed to fn is only valid until fn returns.
+func readKeys(files []string, stdin io.Reader, fn func(key []byte)) error {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, file := range files {
+		if err := readKeyFile(file, stdin, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readKeyFile calls fn with every key of file, or of stdin when file is "-", and closes file before it returns.
+func readKeyFile(file string, stdin io.Reader, fn func(key []byte)) error {
+	r := stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxKeyLen)
+	for s.Scan() {
+		key := s.Bytes()
+		if n := len(key); n > 0 && key[n-1] == '\r' {
+			key = key[:n-1]
+		}
+		if len(key) > 0 {
+			fn(key)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+	return nil
+}
+
+// readFilter reads the bloom filter file at path.
+func readFilter(path string) (*bloomfilter.BloomFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bf, err := bloomfilter.NewFromReader(f, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return bf, nil
+}
+
+// writeFilter writes bf to the file at path, or to stdout when path is empty or "-".
+// A file is written under a temporary name first and renamed, so that it is never left half written.
+// It gets the mode of the file it replaces, or 0666 minus the umask when there is none, as os.Create would give it.
+func writeFilter(path string, bf *bloomfilter.BloomFilter, stdout io.Writer) error {
+	if path == "" || path == "-" {
+		_, err := bf.WriteTo(stdout)
+		return err
+	}
+
+	f, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if fi, err := os.Stat(path); err == nil {
+		if err := f.Chmod(fi.Mode().Perm()); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(f)
+	if _, err := bf.WriteTo(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// createTemp creates a new file next to path to be renamed to path. Unlike os.CreateTemp, which creates files
+// with mode 0600, it creates them with mode 0666 minus the umask.
+func createTemp(path string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%v.%v.%v", filepath.Base(path), os.Getpid(), i))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return f, err
+	}
+}
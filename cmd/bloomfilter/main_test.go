@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// runCommand runs the command given by args with stdin and returns its exit status, stdout and stderr.
+func runCommand(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestBuildQuery(t *testing.T) {
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys.txt")
+	if err := os.WriteFile(keys, []byte("apple\r\nbanana\n\ncherry\n"), 0644); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	file := filepath.Join(dir, "fruits.bf")
+
+	if code, _, stderr := runCommand("date\n", "build", "-p", "0.001", "-o", file, keys, "-"); code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+	}{
+		{[]string{"apple", "banana"}, "", exitOK, "apple\ttrue\nbanana\ttrue\n"},
+		{[]string{"cherry", "durian"}, "", exitMiss, "cherry\ttrue\ndurian\tfalse\n"},
+		{nil, "date\napple\n", exitOK, "date\ttrue\napple\ttrue\n"},
+		{nil, "elderberry\n", exitMiss, "elderberry\tfalse\n"},
+		{[]string{"-q", "fig"}, "", exitMiss, ""},
+		{[]string{"-q", "date"}, "", exitOK, ""},
+	}
+	for _, tt := range tests {
+		args := append([]string{"query", "-f", file}, tt.args...)
+		code, stdout, stderr := runCommand(tt.stdin, args...)
+		if code != tt.code || stdout != tt.stdout {
+			t.Errorf("%v with input %q: expected exit status %v and output %q, actual %v and %q (%v)", args, tt.stdin, tt.code, tt.stdout, code, stdout, stderr)
+		}
+	}
+}
+
+func TestBuildToStdout(t *testing.T) {
+	code, stdout, stderr := runCommand("a\nb\n", "build", "-n", "1000")
+	if code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+	file := filepath.Join(t.TempDir(), "out.bf")
+	if err := os.WriteFile(file, []byte(stdout), 0644); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	code, stdout, _ = runCommand("", "info", file)
+	if code != exitOK || !strings.Contains(stdout, "count:              2\n") || !strings.Contains(stdout, "capacity:           1000\n") {
+		t.Errorf("info: expected exit status %v and a count of 2 and capacity of 1000, actual %v and %q", exitOK, code, stdout)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	a, b, merged := filepath.Join(dir, "a.bf"), filepath.Join(dir, "b.bf"), filepath.Join(dir, "merged.bf")
+	if code, _, stderr := runCommand("x\ny\n", "build", "-n", "100", "-o", a); code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+	if code, _, stderr := runCommand("z\n", "build", "-n", "100", "-o", b); code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+
+	if code, _, stderr := runCommand("", "merge", "-o", merged, a, b); code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+	if code, stdout, _ := runCommand("", "query", "-f", merged, "x", "y", "z"); code != exitOK {
+		t.Errorf("query of merged filter: expected exit status %v, actual %v and %q", exitOK, code, stdout)
+	}
+
+	// a filter of a different size can not be merged
+	other := filepath.Join(dir, "other.bf")
+	if code, _, stderr := runCommand("x\n", "build", "-n", "5000", "-o", other); code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+	if code, _, stderr := runCommand("", "merge", a, other); code != exitError || !strings.Contains(stderr, "other.bf") {
+		t.Errorf("merge of incompatible filters: expected exit status %v and an error naming other.bf, actual %v and %q", exitError, code, stderr)
+	}
+}
+
+// Written files must be readable as any other new file is, and an overwritten file must keep its mode.
+func TestWriteMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported")
+	}
+	dir := t.TempDir()
+	reference := filepath.Join(dir, "reference")
+	f, err := os.OpenFile(reference, os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	f.Close()
+	expected, err := os.Stat(reference)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	file := filepath.Join(dir, "new.bf")
+	if code, _, stderr := runCommand("x\n", "build", "-n", "100", "-o", file); code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if fi.Mode().Perm() != expected.Mode().Perm() {
+		t.Errorf("new file: expected mode %v, actual %v", expected.Mode().Perm(), fi.Mode().Perm())
+	}
+
+	if err := os.Chmod(file, 0640); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if code, _, stderr := runCommand("", "merge", "-o", file, file, file); code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+	if fi, err = os.Stat(file); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("overwritten file: expected mode %v, actual %v", os.FileMode(0640), fi.Mode().Perm())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.bf")
+	if err := os.WriteFile(garbage, []byte("not a bloom filter"), 0644); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	// a filter file whose header claims 1<<62 bits, and that is cut off right after the header
+	valid := filepath.Join(dir, "valid.bf")
+	if code, _, stderr := runCommand("a\nb\n", "build", "-o", valid); code != exitOK {
+		t.Log(stderr)
+		t.FailNow()
+	}
+	data, err := os.ReadFile(valid)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	binary.LittleEndian.PutUint64(data[8:16], 1<<62)
+	corrupt := filepath.Join(dir, "corrupt.bf")
+	if err := os.WriteFile(corrupt, data[:40], 0644); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	tests := [][]string{
+		nil,
+		{"unknown"},
+		{"build", "-p", "2"},
+		{"build", "-x"},
+		{"build", filepath.Join(dir, "missing.txt")},
+		{"query", "key"},
+		{"query", "-f", filepath.Join(dir, "missing.bf"), "key"},
+		{"query", "-f", garbage, "key"},
+		{"info"},
+		{"info", garbage},
+		{"merge", garbage},
+		{"merge", garbage, garbage},
+		{"query", "-f", corrupt, "key"},
+		{"info", corrupt},
+		{"merge", valid, corrupt},
+	}
+	for _, args := range tests {
+		if code, _, stderr := runCommand("", args...); code != exitError || stderr == "" {
+			t.Errorf("%v: expected exit status %v and an error, actual %v and %q", args, exitError, code, stderr)
+		}
+	}
+}
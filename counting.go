@@ -0,0 +1,170 @@
+package bloomfilter
+
+import (
+	"hash"
+)
+
+// CountingBloomFilter is a non-thread safe bloom filter data structure that keeps a small counter
+// instead of a single bit at every location, which makes it possible to remove elements.
+//
+// Counters are either 4 or 8 bits wide. A counter that reaches its maximum value saturates: it is
+// neither incremented nor decremented anymore, so that removing other elements can never cause a false negative.
+type CountingBloomFilter struct {
+	hasher           Hasher
+	numHashFunctions uint8
+	size             uint64 // number of counters
+	counters         counters
+}
+
+// Add takes a byte slice as input and increments its counters in the CountingBloomFilter structure.
+// Counters that are already at their maximum value are left unchanged.
+func (cbf *CountingBloomFilter) Add(data []byte) {
+	hash1Val, hash2Val := cbf.hasher.Sum128(data)
+
+	for i := uint8(0); i < cbf.numHashFunctions; i++ {
+		loc := location(hash1Val, hash2Val, i, cbf.size)
+		if c := cbf.counters.get(loc); c < cbf.counters.max {
+			cbf.counters.set(loc, c+1)
+		}
+	}
+}
+
+// Query tests the byte slice input's existence in the CountingBloomFilter structure and returns a boolean value.
+// As with BloomFilter, false positives are possible, while false negatives are not.
+func (cbf *CountingBloomFilter) Query(data []byte) bool {
+	hash1Val, hash2Val := cbf.hasher.Sum128(data)
+
+	for i := uint8(0); i < cbf.numHashFunctions; i++ {
+		if cbf.counters.get(location(hash1Val, hash2Val, i, cbf.size)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove takes a byte slice as input and decrements its counters in the CountingBloomFilter structure.
+// Saturated counters are left unchanged.
+// When a counter of the byte slice input is already zero, the input was never added and ErrCounterUnderflow
+// is returned without modifying the CountingBloomFilter structure.
+// Removing an element that was not added, but tests positive as a false positive, corrupts the counters
+// of other elements and should be avoided.
+func (cbf *CountingBloomFilter) Remove(data []byte) error {
+	hash1Val, hash2Val := cbf.hasher.Sum128(data)
+
+	for i := uint8(0); i < cbf.numHashFunctions; i++ {
+		loc := location(hash1Val, hash2Val, i, cbf.size)
+		c := cbf.counters.get(loc)
+		if c == cbf.counters.max {
+			continue
+		}
+		if c == 0 {
+			// undo the decrements that were already made
+			for j := uint8(0); j < i; j++ {
+				l := location(hash1Val, hash2Val, j, cbf.size)
+				if c := cbf.counters.get(l); c < cbf.counters.max {
+					cbf.counters.set(l, c+1)
+				}
+			}
+			return ErrCounterUnderflow
+		}
+		cbf.counters.set(loc, c-1)
+	}
+	return nil
+}
+
+// Count returns an estimate of how many times the byte slice input was added to the CountingBloomFilter structure.
+// The estimate is never less than the actual number, unless a counter of the input is saturated
+// or an element that was not added has been removed.
+func (cbf *CountingBloomFilter) Count(data []byte) uint64 {
+	hash1Val, hash2Val := cbf.hasher.Sum128(data)
+
+	min := cbf.counters.max
+	for i := uint8(0); i < cbf.numHashFunctions; i++ {
+		if c := cbf.counters.get(location(hash1Val, hash2Val, i, cbf.size)); c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// NewCountingByEstimates requires estimated number of items, estimated false positive rate and the width of
+// each counter in bits, which is either 4 or 8, to create a CountingBloomFilter structure.
+// The number of counters and number of hash functions are calculated the same way as in NewByEstimates.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewCountingByEstimates(numItems uint64, fpRate float64, counterWidth uint8, hash1 hash.Hash64, hash2 hash.Hash64) (*CountingBloomFilter, error) {
+	if numItems == 0 {
+		return nil, ErrInvalidNumberOfItems
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, ErrInvalidFalsePositiveRate
+	}
+	size, numHashFunctions, err := estimates(numItems, fpRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCountingBySizeAndNumHashFuncs(size, numHashFunctions, counterWidth, hash1, hash2)
+}
+
+// NewCountingBySizeAndNumHashFuncs requires number of counters, number of hash functions that will be created
+// via double hashing of hash function hash1 and hash function hash2, and the width of each counter in bits,
+// which is either 4 or 8.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewCountingBySizeAndNumHashFuncs(size uint64, numHashFunctions uint8, counterWidth uint8, hash1 hash.Hash64, hash2 hash.Hash64) (*CountingBloomFilter, error) {
+	if size == 0 {
+		return nil, ErrInvalidSize
+	}
+	if size > MaxSize {
+		return nil, ErrSizeOverflow
+	}
+	if numHashFunctions == 0 {
+		return nil, ErrInvalidNumberOfHashFunctions
+	}
+	if counterWidth != 4 && counterWidth != 8 {
+		return nil, ErrInvalidCounterWidth
+	}
+
+	cbf := CountingBloomFilter{
+		hasher:           hasherOf(hash1, hash2),
+		numHashFunctions: numHashFunctions,
+		size:             size,
+		counters:         newCounters(size, counterWidth),
+	}
+
+	return &cbf, nil
+}
+
+// counters is an array of unsigned counters of width bits each, packed into uint64 words.
+// width must divide 64 so that no counter spans two words.
+type counters struct {
+	width uint8
+	max   uint64
+	words []uint64
+}
+
+func newCounters(n uint64, width uint8) counters {
+	perWord := uint64(64 / width)
+	l := n / perWord
+	if n%perWord > 0 {
+		l++
+	}
+
+	return counters{
+		width: width,
+		max:   1<<width - 1,
+		words: make([]uint64, l),
+	}
+}
+
+func (c counters) get(i uint64) uint64 {
+	perWord := uint64(64 / c.width)
+	shift := (i % perWord) * uint64(c.width)
+	return (c.words[i/perWord] >> shift) & c.max
+}
+
+func (c counters) set(i uint64, v uint64) {
+	perWord := uint64(64 / c.width)
+	shift := (i % perWord) * uint64(c.width)
+	w := &c.words[i/perWord]
+	*w = *w&^(c.max<<shift) | (v&c.max)<<shift
+}
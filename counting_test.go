@@ -0,0 +1,170 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestCountingBloomFilterInit(t *testing.T) {
+	tests := []struct {
+		size             uint64
+		numHashFunctions uint8
+		counterWidth     uint8
+		err              error
+	}{
+		{0, 3, 4, ErrInvalidSize},
+		{100, 0, 4, ErrInvalidNumberOfHashFunctions},
+		{100, 3, 0, ErrInvalidCounterWidth},
+		{100, 3, 2, ErrInvalidCounterWidth},
+		{100, 3, 16, ErrInvalidCounterWidth},
+		{100, 3, 4, nil},
+		{100, 3, 8, nil},
+	}
+	for _, tt := range tests {
+		cbf, err := NewCountingBySizeAndNumHashFuncs(tt.size, tt.numHashFunctions, tt.counterWidth, nil, nil)
+		if err != tt.err {
+			t.Errorf("expected error %v for size %v, numHashFunctions %v, counterWidth %v, actual %v", tt.err, tt.size, tt.numHashFunctions, tt.counterWidth, err)
+		}
+		if (cbf == nil) != (tt.err != nil) {
+			t.Errorf("unexpected counting bloom filter %v for size %v, numHashFunctions %v, counterWidth %v", cbf, tt.size, tt.numHashFunctions, tt.counterWidth)
+		}
+	}
+
+	if _, err := NewCountingByEstimates(0, 0.01, 4, nil, nil); err != ErrInvalidNumberOfItems {
+		t.Errorf("expected error %v, actual %v", ErrInvalidNumberOfItems, err)
+	}
+	if _, err := NewCountingByEstimates(100, 1.0, 4, nil, nil); err != ErrInvalidFalsePositiveRate {
+		t.Errorf("expected error %v, actual %v", ErrInvalidFalsePositiveRate, err)
+	}
+}
+
+func TestCountingBloomFilterBasics(t *testing.T) {
+	for _, counterWidth := range []uint8{4, 8} {
+		var (
+			count     = 10000
+			numItems  = uint64(count)
+			fp        = 0.01
+			maxStrLen = 50
+			minStrLen = 20
+		)
+
+		tests := prepTestCases(count, minStrLen, maxStrLen)
+
+		cbf, err := NewCountingByEstimates(numItems, fp, counterWidth, nil, nil)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+
+		for _, tt := range tests {
+			cbf.Add(tt.data)
+		}
+		for _, tt := range tests {
+			if result := cbf.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+			if c := cbf.Count(tt.data); c == 0 {
+				t.Errorf("Count(%v): expected at least %v, actual %v", string(tt.data), 1, c)
+			}
+		}
+
+		// remove the first half and make sure that the second half is still there
+		for _, tt := range tests[:count/2] {
+			if err := cbf.Remove(tt.data); err != nil {
+				t.Errorf("Remove(%v): expected nil error, actual %v", string(tt.data), err)
+			}
+		}
+		for _, tt := range tests[count/2:] {
+			if result := cbf.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+		}
+
+		removed := 0
+		for _, tt := range tests[:count/2] {
+			if !cbf.Query(tt.data) {
+				removed++
+			}
+		}
+		if removed < count/4 {
+			t.Errorf("expected most removed items to test negative, only %v out of %v did", removed, count/2)
+		}
+	}
+}
+
+func TestCountingBloomFilterUnderflow(t *testing.T) {
+	cbf, err := NewCountingBySizeAndNumHashFuncs(1000, 5, 4, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	cbf.Add([]byte("data"))
+	if err := cbf.Remove([]byte("other data")); err != ErrCounterUnderflow {
+		t.Errorf("expected error %v, actual %v", ErrCounterUnderflow, err)
+	}
+	if c := cbf.Count([]byte("data")); c != 1 {
+		t.Errorf("expected a failed Remove to leave counters unchanged, Count is %v", c)
+	}
+	if err := cbf.Remove([]byte("data")); err != nil {
+		t.Errorf("expected nil error, actual %v", err)
+	}
+	if err := cbf.Remove([]byte("data")); err != ErrCounterUnderflow {
+		t.Errorf("expected error %v, actual %v", ErrCounterUnderflow, err)
+	}
+	for i, w := range cbf.counters.words {
+		if w != 0 {
+			t.Errorf("expected all counters to be zero, word %v is %x", i, w)
+		}
+	}
+}
+
+func TestCountingBloomFilterOverflow(t *testing.T) {
+	for _, counterWidth := range []uint8{4, 8} {
+		cbf, err := NewCountingBySizeAndNumHashFuncs(1000, 5, counterWidth, nil, nil)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+
+		max := uint64(1)<<counterWidth - 1
+		for i := uint64(0); i < max+10; i++ {
+			cbf.Add([]byte("data"))
+		}
+		if c := cbf.Count([]byte("data")); c != max {
+			t.Errorf("expected Count to saturate at %v, actual %v", max, c)
+		}
+
+		// saturated counters are never decremented
+		for i := uint64(0); i < max+10; i++ {
+			if err := cbf.Remove([]byte("data")); err != nil {
+				t.Errorf("expected nil error, actual %v", err)
+			}
+		}
+		if result := cbf.Query([]byte("data")); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", "data", true, false)
+		}
+	}
+}
+
+func TestCountingBloomFilterAllocs(t *testing.T) {
+	data := []byte("data")
+	cbf, err := NewCountingBySizeAndNumHashFuncs(1000, 7, 4, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	ops := []struct {
+		description string
+		fn          func()
+	}{
+		{"Add", func() { cbf.Add(data) }},
+		{"Query", func() { cbf.Query(data) }},
+		{"Count", func() { cbf.Count(data) }},
+		{"Remove", func() { cbf.Remove(data) }},
+	}
+	for _, op := range ops {
+		if allocs := testing.AllocsPerRun(100, op.fn); allocs != 0 {
+			t.Errorf("%v: expected 0 allocations, actual %v", op.description, allocs)
+		}
+	}
+}
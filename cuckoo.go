@@ -0,0 +1,513 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+const (
+	// DefaultBucketSize is the number of fingerprints in a bucket of a CuckooFilter when none is provided.
+	DefaultBucketSize uint8 = 4
+
+	// MaxKicks is the number of fingerprints that Insert moves to their alternate buckets to make room
+	// for a new one before it gives up with ErrMaxKicksExceeded.
+	MaxKicks = 500
+
+	// maxFingerprintBits is the maximum number of bits of a fingerprint of a CuckooFilter.
+	maxFingerprintBits = 32
+)
+
+// CuckooFilter is a non-thread safe cuckoo filter data structure, as described in "Cuckoo Filter: Practically Better
+// Than Bloom" by Fan, Andersen, Kaminsky and Mitzenmacher.
+//
+// Instead of setting bits, it stores a short fingerprint of every element in one of two buckets, so that elements can
+// also be deleted. The alternate bucket of a fingerprint is derived from the fingerprint itself, which makes it possible
+// to move fingerprints between their buckets to make room for new ones.
+// For false positive rates below about 0.3%, a cuckoo filter takes less space than a BloomFilter structure.
+//
+// Unlike with a bloom filter, inserting into a nearly full cuckoo filter fails, and inserting the same element
+// more than 2 * bucketSize times always fails.
+type CuckooFilter struct {
+	hasher          Hasher
+	hashScheme      uint64
+	bucketSize      uint8
+	fingerprintBits uint8
+	numBuckets      uint64
+	slots           fingerprints
+	count           uint64 // number of fingerprints
+	rng             uint64 // state of the generator that chooses fingerprints to move
+}
+
+// CuckooFilterTS is a CuckooFilter structure with a RWMutex for thread safety.
+type CuckooFilterTS struct {
+	cf  *CuckooFilter
+	mtx sync.RWMutex
+}
+
+// fingerprints is an array of fingerprints of width bits each, packed into 64-bit words.
+// A fingerprint may span two words. The zero fingerprint marks an empty slot.
+type fingerprints struct {
+	width uint8
+	words []uint64
+}
+
+func newFingerprints(n uint64, width uint8) fingerprints {
+	return fingerprints{width: width, words: make([]uint64, numWords(n*uint64(width)))}
+}
+
+func (f fingerprints) get(i uint64) uint64 {
+	offset := i * uint64(f.width)
+	w, shift := offset/64, offset%64
+	v := f.words[w] >> shift
+	if shift+uint64(f.width) > 64 {
+		v |= f.words[w+1] << (64 - shift)
+	}
+	return v & (1<<f.width - 1)
+}
+
+func (f fingerprints) set(i uint64, v uint64) {
+	offset := i * uint64(f.width)
+	w, shift := offset/64, offset%64
+	mask := uint64(1)<<f.width - 1
+	f.words[w] = f.words[w]&^(mask<<shift) | v<<shift
+	if shift+uint64(f.width) > 64 {
+		f.words[w+1] = f.words[w+1]&^(mask>>(64-shift)) | v>>(64-shift)
+	}
+}
+
+// indexAndFingerprint returns the first bucket and the fingerprint of data, which is never zero.
+func (cf *CuckooFilter) indexAndFingerprint(data []byte) (uint64, uint64) {
+	hash1Val, hash2Val := cf.hasher.Sum128(data)
+	fp := hash2Val >> (64 - cf.fingerprintBits)
+	if fp == 0 {
+		fp = 1
+	}
+	i, _ := bits.Mul64(hash1Val, cf.numBuckets)
+	return i, fp
+}
+
+// altIndex returns the other bucket of fingerprint fp in bucket i. altIndex(altIndex(i, fp), fp) is i.
+// A hash of fp is reduced to a bucket h. With a power of two number of buckets, the other bucket is i XOR h,
+// as in the paper, and otherwise, where i XOR h may be out of range, it is h - i modulo the number of buckets.
+func (cf *CuckooFilter) altIndex(i uint64, fp uint64) uint64 {
+	h, _ := bits.Mul64(mix64(fp), cf.numBuckets)
+	if cf.numBuckets&(cf.numBuckets-1) == 0 {
+		return i ^ h
+	}
+	if h < i {
+		h += cf.numBuckets
+	}
+	return h - i
+}
+
+// insertInto stores fp in an empty slot of bucket i and reports whether there was one.
+func (cf *CuckooFilter) insertInto(i uint64, fp uint64) bool {
+	for s := i * uint64(cf.bucketSize); s < (i+1)*uint64(cf.bucketSize); s++ {
+		if cf.slots.get(s) == 0 {
+			cf.slots.set(s, fp)
+			return true
+		}
+	}
+	return false
+}
+
+// countIn returns the number of slots of bucket i that hold fp.
+func (cf *CuckooFilter) countIn(i uint64, fp uint64) uint64 {
+	var c uint64
+	for s := i * uint64(cf.bucketSize); s < (i+1)*uint64(cf.bucketSize); s++ {
+		if cf.slots.get(s) == fp {
+			c++
+		}
+	}
+	return c
+}
+
+// deleteFrom empties a slot of bucket i that holds fp and reports whether there was one.
+func (cf *CuckooFilter) deleteFrom(i uint64, fp uint64) bool {
+	for s := i * uint64(cf.bucketSize); s < (i+1)*uint64(cf.bucketSize); s++ {
+		if cf.slots.get(s) == fp {
+			cf.slots.set(s, 0)
+			return true
+		}
+	}
+	return false
+}
+
+// random returns the next value of a xorshift64* generator.
+func (cf *CuckooFilter) random() uint64 {
+	cf.rng ^= cf.rng >> 12
+	cf.rng ^= cf.rng << 25
+	cf.rng ^= cf.rng >> 27
+	return cf.rng * 0x2545f4914f6cdd1d
+}
+
+// Insert takes a byte slice as input and stores its fingerprint in the CuckooFilter structure.
+// When both buckets of the input are full, fingerprints are moved to their alternate buckets to make room,
+// up to MaxKicks times. When there is still no room, ErrMaxKicksExceeded is returned and every moved fingerprint
+// is put back, so that the CuckooFilter structure is left unchanged.
+func (cf *CuckooFilter) Insert(data []byte) error {
+	i1, fp := cf.indexAndFingerprint(data)
+	if cf.insertInto(i1, fp) || cf.insertInto(cf.altIndex(i1, fp), fp) {
+		cf.count++
+		return nil
+	}
+
+	i := i1
+	if cf.random()&1 == 1 {
+		i = cf.altIndex(i1, fp)
+	}
+	path := make([]uint64, 0, MaxKicks)
+	for n := 0; n < MaxKicks; n++ {
+		s := i*uint64(cf.bucketSize) + cf.random()%uint64(cf.bucketSize)
+		evicted := cf.slots.get(s)
+		cf.slots.set(s, fp)
+		path = append(path, s)
+		fp = evicted
+		i = cf.altIndex(i, fp)
+		if cf.insertInto(i, fp) {
+			cf.count++
+			return nil
+		}
+	}
+
+	// undo the moves in reverse order, until the fingerprint of the input is evicted again
+	for n := len(path) - 1; n >= 0; n-- {
+		s := path[n]
+		moved := cf.slots.get(s)
+		cf.slots.set(s, fp)
+		fp = moved
+	}
+	return ErrMaxKicksExceeded
+}
+
+// Lookup tests the byte slice input's existence in the CuckooFilter structure and returns a boolean value.
+// As with BloomFilter, false positives are possible, while false negatives are not.
+func (cf *CuckooFilter) Lookup(data []byte) bool {
+	i1, fp := cf.indexAndFingerprint(data)
+	return cf.countIn(i1, fp) > 0 || cf.countIn(cf.altIndex(i1, fp), fp) > 0
+}
+
+// Delete takes a byte slice as input and removes one copy of its fingerprint from the CuckooFilter structure.
+// It reports whether a copy was found.
+// Deleting an element that was not inserted, but tests positive as a false positive, removes the fingerprint
+// of another element and causes a false negative, so only inserted elements should be deleted.
+func (cf *CuckooFilter) Delete(data []byte) bool {
+	i1, fp := cf.indexAndFingerprint(data)
+	if cf.deleteFrom(i1, fp) || cf.deleteFrom(cf.altIndex(i1, fp), fp) {
+		cf.count--
+		return true
+	}
+	return false
+}
+
+// Count returns how many copies of the fingerprint of the byte slice input the CuckooFilter structure holds,
+// which is the number of times the input was inserted and not deleted, plus the number of elements
+// with the same fingerprint and buckets.
+func (cf *CuckooFilter) Count(data []byte) uint64 {
+	i1, fp := cf.indexAndFingerprint(data)
+	c := cf.countIn(i1, fp)
+	if i2 := cf.altIndex(i1, fp); i2 != i1 {
+		c += cf.countIn(i2, fp)
+	}
+	return c
+}
+
+// Len returns the number of fingerprints that the CuckooFilter structure holds.
+func (cf *CuckooFilter) Len() uint64 {
+	return cf.count
+}
+
+// LoadFactor returns the ratio of the number of fingerprints to the number of slots of the CuckooFilter structure.
+// Insert starts failing at a load factor of about 0.84, 0.95 and 0.98 for bucket sizes of 2, 4 and 8.
+func (cf *CuckooFilter) LoadFactor() float64 {
+	return float64(cf.count) / float64(cf.numBuckets*uint64(cf.bucketSize))
+}
+
+// cuckooMaxLoadFactor returns the load factor that a CuckooFilter with buckets of bucketSize fingerprints
+// can be filled up to before Insert starts failing.
+func cuckooMaxLoadFactor(bucketSize uint8) float64 {
+	switch bucketSize {
+	case 2:
+		return 0.84
+	case 4:
+		return 0.95
+	default:
+		return 0.98
+	}
+}
+
+// cuckooEstimates returns the number of buckets and the number of bits of a fingerprint of a CuckooFilter
+// with buckets of bucketSize fingerprints that holds numItems items with a false positive rate of fpRate.
+// A Lookup compares 2 * bucketSize fingerprints, each of which matches with a probability of 2^-fingerprintBits.
+func cuckooEstimates(numItems uint64, fpRate float64, bucketSize uint8) (uint64, uint8) {
+	fingerprintBits := uint8(maxFingerprintBits)
+	if f := math.Ceil(math.Log2(2 * float64(bucketSize) / fpRate)); f < maxFingerprintBits {
+		fingerprintBits = uint8(f)
+	}
+	numBuckets := uint64(math.Ceil(float64(numItems) / (float64(bucketSize) * cuckooMaxLoadFactor(bucketSize))))
+
+	return numBuckets, fingerprintBits
+}
+
+// NewCuckooByEstimates requires estimated number of items, estimated false positive rate and the number of
+// fingerprints in a bucket, which is 2, 4 or 8, to create a CuckooFilter structure.
+// When bucketSize is 0, DefaultBucketSize is used.
+// The number of bits of a fingerprint is ceil(log2(2 * bucketSize / fpRate)), up to 32, and the number of buckets
+// is just large enough to hold numItems items at the maximum load factor of the bucket size.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewCuckooByEstimates(numItems uint64, fpRate float64, bucketSize uint8, hash1 hash.Hash64, hash2 hash.Hash64) (*CuckooFilter, error) {
+	return NewCuckooByEstimatesWithHasher(numItems, fpRate, bucketSize, hasherOf(hash1, hash2))
+}
+
+// NewCuckooBySize requires the number of buckets, the number of fingerprints in a bucket, which is 2, 4 or 8,
+// and the number of bits of a fingerprint, which is between 1 and 32, to create a CuckooFilter structure.
+// When bucketSize is 0, DefaultBucketSize is used. numBuckets need not be a power of two, and ErrInvalidSize
+// is returned when the fingerprints of all buckets would take more than MaxSize bits.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewCuckooBySize(numBuckets uint64, bucketSize uint8, fingerprintBits uint8, hash1 hash.Hash64, hash2 hash.Hash64) (*CuckooFilter, error) {
+	return NewCuckooBySizeWithHasher(numBuckets, bucketSize, fingerprintBits, hasherOf(hash1, hash2))
+}
+
+// NewCuckooByEstimatesWithHasher returns a new CuckooFilter structure. For more details, please see
+// NewCuckooByEstimates and NewByEstimatesWithHasher functions.
+func NewCuckooByEstimatesWithHasher(numItems uint64, fpRate float64, bucketSize uint8, h Hasher) (*CuckooFilter, error) {
+	if numItems == 0 {
+		return nil, ErrInvalidNumberOfItems
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, ErrInvalidFalsePositiveRate
+	}
+	if bucketSize == 0 {
+		bucketSize = DefaultBucketSize
+	}
+	if !validBucketSize(bucketSize) {
+		return nil, ErrInvalidBucketSize
+	}
+	numBuckets, fingerprintBits := cuckooEstimates(numItems, fpRate, bucketSize)
+
+	return NewCuckooBySizeWithHasher(numBuckets, bucketSize, fingerprintBits, h)
+}
+
+// NewCuckooBySizeWithHasher returns a new CuckooFilter structure. For more details, please see
+// NewCuckooBySize and NewBySizeAndNumHashFuncsWithHasher functions.
+func NewCuckooBySizeWithHasher(numBuckets uint64, bucketSize uint8, fingerprintBits uint8, h Hasher) (*CuckooFilter, error) {
+	if numBuckets == 0 || numBuckets > 1<<62 {
+		return nil, ErrInvalidSize
+	}
+	if bucketSize == 0 {
+		bucketSize = DefaultBucketSize
+	}
+	if !validBucketSize(bucketSize) {
+		return nil, ErrInvalidBucketSize
+	}
+	if fingerprintBits == 0 || fingerprintBits > maxFingerprintBits {
+		return nil, ErrInvalidFingerprintBits
+	}
+	if !validCuckooSize(numBuckets, bucketSize, fingerprintBits) {
+		return nil, ErrInvalidSize
+	}
+	if h == nil {
+		h = fnvHasher{}
+	}
+
+	return newCuckooFilter(numBuckets, bucketSize, fingerprintBits, h), nil
+}
+
+// newCuckooFilter returns a new CuckooFilter structure without validating its parameters.
+func newCuckooFilter(numBuckets uint64, bucketSize uint8, fingerprintBits uint8, h Hasher) *CuckooFilter {
+	cf := CuckooFilter{
+		hasher:          h,
+		hashScheme:      hashScheme(h),
+		bucketSize:      bucketSize,
+		fingerprintBits: fingerprintBits,
+		numBuckets:      numBuckets,
+		slots:           newFingerprints(numBuckets*uint64(bucketSize), fingerprintBits),
+		rng:             cuckooSeed,
+	}
+
+	return &cf
+}
+
+// validCuckooSize reports whether the fingerprints of a CuckooFilter of numBuckets buckets take at most MaxSize bits.
+// The multiplication is checked for overflow, since numBuckets may come from an encoding.
+func validCuckooSize(numBuckets uint64, bucketSize uint8, fingerprintBits uint8) bool {
+	hi, lo := bits.Mul64(numBuckets, uint64(bucketSize)*uint64(fingerprintBits))
+	return hi == 0 && lo <= MaxSize
+}
+
+// cuckooSeed is the initial state of the generator that chooses fingerprints to move,
+// so that a CuckooFilter structure is deterministic.
+const cuckooSeed = 0x9e3779b97f4a7c15
+
+// validBucketSize reports whether a CuckooFilter can have buckets of bucketSize fingerprints.
+// Buckets of a single fingerprint are not supported, since with them Insert fails now and then
+// even when the cuckoo filter is far from full.
+func validBucketSize(bucketSize uint8) bool {
+	return bucketSize == 2 || bucketSize == 4 || bucketSize == 8
+}
+
+// A serialized CuckooFilter has the following layout, all integers being little endian:
+//
+//	offset  length  field
+//	0       4       magic "BLMC"
+//	4       1       format version
+//	5       1       bucket size
+//	6       1       number of bits of a fingerprint
+//	7       1       reserved, zero
+//	8       8       number of buckets
+//	16      8       hash scheme identifier
+//	24      8       number of fingerprints
+//	32      8*n     packed fingerprints, n = ceil(number of buckets * bucket size * bits of a fingerprint / 64)
+//	32+8*n  4       CRC-32C of all preceding bytes
+const (
+	cuckooEncodingMagic   = "BLMC"
+	cuckooEncodingVersion = 1
+	cuckooHeaderLen       = 32
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The returned byte slice holds the number of buckets, bucket size, number of bits of a fingerprint,
+// an identifier of the hash functions and the fingerprints of the CuckooFilter structure, followed by a checksum.
+func (cf *CuckooFilter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, cuckooHeaderLen+8*len(cf.slots.words)+checksumLen)
+	copy(data[0:4], cuckooEncodingMagic)
+	data[4] = cuckooEncodingVersion
+	data[5] = cf.bucketSize
+	data[6] = cf.fingerprintBits
+	binary.LittleEndian.PutUint64(data[8:16], cf.numBuckets)
+	binary.LittleEndian.PutUint64(data[16:24], cf.hashScheme)
+	binary.LittleEndian.PutUint64(data[24:32], cf.count)
+	for i, w := range cf.slots.words {
+		binary.LittleEndian.PutUint64(data[cuckooHeaderLen+8*i:], w)
+	}
+	end := len(data) - checksumLen
+	binary.LittleEndian.PutUint32(data[end:], crc32.Checksum(data[:end], castagnoli))
+
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// The hash functions of the receiver are kept, and when the receiver has none, default hash functions are used.
+// ErrHashSchemeMismatch is returned when data was produced by a CuckooFilter with different hash functions.
+func (cf *CuckooFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < cuckooHeaderLen+checksumLen || string(data[0:4]) != cuckooEncodingMagic {
+		return ErrInvalidEncoding
+	}
+	if data[4] != cuckooEncodingVersion {
+		return ErrUnsupportedVersion
+	}
+	bucketSize, fingerprintBits := data[5], data[6]
+	numBuckets := binary.LittleEndian.Uint64(data[8:16])
+	if !validBucketSize(bucketSize) || fingerprintBits == 0 || fingerprintBits > maxFingerprintBits ||
+		numBuckets == 0 || numBuckets > 1<<62 ||
+		!validCuckooSize(numBuckets, bucketSize, fingerprintBits) {
+		return ErrInvalidEncoding
+	}
+	n := numWords(numBuckets * uint64(bucketSize) * uint64(fingerprintBits))
+	if uint64(len(data)) != cuckooHeaderLen+8*n+checksumLen {
+		return ErrInvalidEncoding
+	}
+	end := len(data) - checksumLen
+	if crc32.Checksum(data[:end], castagnoli) != binary.LittleEndian.Uint32(data[end:]) {
+		return ErrChecksumMismatch
+	}
+
+	h := cf.hasher
+	if h == nil {
+		h = fnvHasher{}
+	}
+	loaded := newCuckooFilter(numBuckets, bucketSize, fingerprintBits, h)
+	if loaded.hashScheme != binary.LittleEndian.Uint64(data[16:24]) {
+		return ErrHashSchemeMismatch
+	}
+	loaded.count = binary.LittleEndian.Uint64(data[24:32])
+	for i := range loaded.slots.words {
+		loaded.slots.words[i] = binary.LittleEndian.Uint64(data[cuckooHeaderLen+8*i:])
+	}
+	*cf = *loaded
+
+	return nil
+}
+
+// Insert for thread safe CuckooFilterTS structure serves the same purpose as Insert for CuckooFilter structure.
+func (cfts *CuckooFilterTS) Insert(data []byte) error {
+	cfts.mtx.Lock()
+	defer cfts.mtx.Unlock()
+	return cfts.cf.Insert(data)
+}
+
+// Lookup for thread safe CuckooFilterTS structure serves the same purpose as Lookup for CuckooFilter structure.
+func (cfts *CuckooFilterTS) Lookup(data []byte) bool {
+	cfts.mtx.RLock()
+	defer cfts.mtx.RUnlock()
+	return cfts.cf.Lookup(data)
+}
+
+// Delete for thread safe CuckooFilterTS structure serves the same purpose as Delete for CuckooFilter structure.
+func (cfts *CuckooFilterTS) Delete(data []byte) bool {
+	cfts.mtx.Lock()
+	defer cfts.mtx.Unlock()
+	return cfts.cf.Delete(data)
+}
+
+// Count for thread safe CuckooFilterTS structure serves the same purpose as Count for CuckooFilter structure.
+func (cfts *CuckooFilterTS) Count(data []byte) uint64 {
+	cfts.mtx.RLock()
+	defer cfts.mtx.RUnlock()
+	return cfts.cf.Count(data)
+}
+
+// Len for thread safe CuckooFilterTS structure serves the same purpose as Len for CuckooFilter structure.
+func (cfts *CuckooFilterTS) Len() uint64 {
+	cfts.mtx.RLock()
+	defer cfts.mtx.RUnlock()
+	return cfts.cf.Len()
+}
+
+// LoadFactor for thread safe CuckooFilterTS structure serves the same purpose as LoadFactor for CuckooFilter structure.
+func (cfts *CuckooFilterTS) LoadFactor() float64 {
+	cfts.mtx.RLock()
+	defer cfts.mtx.RUnlock()
+	return cfts.cf.LoadFactor()
+}
+
+// MarshalBinary for thread safe CuckooFilterTS structure serves the same purpose as MarshalBinary for CuckooFilter structure.
+func (cfts *CuckooFilterTS) MarshalBinary() ([]byte, error) {
+	cfts.mtx.RLock()
+	defer cfts.mtx.RUnlock()
+	return cfts.cf.MarshalBinary()
+}
+
+// UnmarshalBinary for thread safe CuckooFilterTS structure serves the same purpose as UnmarshalBinary for CuckooFilter structure.
+func (cfts *CuckooFilterTS) UnmarshalBinary(data []byte) error {
+	cfts.mtx.Lock()
+	defer cfts.mtx.Unlock()
+	if cfts.cf == nil {
+		cfts.cf = &CuckooFilter{}
+	}
+	return cfts.cf.UnmarshalBinary(data)
+}
+
+// NewTSCuckooByEstimates returns a new CuckooFilterTS structure. For more details, please see NewCuckooByEstimates function.
+func NewTSCuckooByEstimates(numItems uint64, fpRate float64, bucketSize uint8, hash1 hash.Hash64, hash2 hash.Hash64) (*CuckooFilterTS, error) {
+	cf, err := NewCuckooByEstimates(numItems, fpRate, bucketSize, hash1, hash2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CuckooFilterTS{cf: cf}, nil
+}
+
+// NewTSCuckooBySize returns a new CuckooFilterTS structure. For more details, please see NewCuckooBySize function.
+func NewTSCuckooBySize(numBuckets uint64, bucketSize uint8, fingerprintBits uint8, hash1 hash.Hash64, hash2 hash.Hash64) (*CuckooFilterTS, error) {
+	cf, err := NewCuckooBySize(numBuckets, bucketSize, fingerprintBits, hash1, hash2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CuckooFilterTS{cf: cf}, nil
+}
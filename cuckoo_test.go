@@ -0,0 +1,360 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"hash/crc64"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestCuckooFilterInit(t *testing.T) {
+	tests := []struct {
+		description string
+		new         func() (*CuckooFilter, error)
+		err         error
+	}{
+		{"zero items", func() (*CuckooFilter, error) { return NewCuckooByEstimates(0, 0.01, 4, nil, nil) }, ErrInvalidNumberOfItems},
+		{"fp rate", func() (*CuckooFilter, error) { return NewCuckooByEstimates(100, 1.0, 4, nil, nil) }, ErrInvalidFalsePositiveRate},
+		{"NaN fp rate", func() (*CuckooFilter, error) { return NewCuckooByEstimates(100, math.NaN(), 4, nil, nil) }, ErrInvalidFalsePositiveRate},
+		{"bucket size", func() (*CuckooFilter, error) { return NewCuckooByEstimates(100, 0.01, 3, nil, nil) }, ErrInvalidBucketSize},
+		{"single fingerprint buckets", func() (*CuckooFilter, error) { return NewCuckooBySize(16, 1, 8, nil, nil) }, ErrInvalidBucketSize},
+		{"zero buckets", func() (*CuckooFilter, error) { return NewCuckooBySize(0, 4, 8, nil, nil) }, ErrInvalidSize},
+		{"zero fingerprint bits", func() (*CuckooFilter, error) { return NewCuckooBySize(16, 4, 0, nil, nil) }, ErrInvalidFingerprintBits},
+		{"too many fingerprint bits", func() (*CuckooFilter, error) { return NewCuckooBySize(16, 4, 33, nil, nil) }, ErrInvalidFingerprintBits},
+		{"fingerprints of more than MaxSize bits", func() (*CuckooFilter, error) { return NewCuckooBySize(1<<62, 8, 32, nil, nil) }, ErrInvalidSize},
+		{"just over MaxSize bits", func() (*CuckooFilter, error) { return NewCuckooBySize(1<<57+1, 8, 32, nil, nil) }, ErrInvalidSize},
+	}
+	for _, tt := range tests {
+		if cf, err := tt.new(); cf != nil || err != tt.err {
+			t.Errorf("%v: expected nil cuckoo filter and error %v, actual %v and %v", tt.description, tt.err, cf, err)
+		}
+	}
+
+	cf, err := NewCuckooBySize(1000, 0, 12, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if cf.numBuckets != 1000 || cf.bucketSize != DefaultBucketSize {
+		t.Errorf("expected 1000 buckets of %v fingerprints, actual %v buckets of %v", DefaultBucketSize, cf.numBuckets, cf.bucketSize)
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	for width := uint8(1); width <= maxFingerprintBits; width++ {
+		n := uint64(200)
+		f := newFingerprints(n, width)
+		max := uint64(1)<<width - 1
+		for i := uint64(0); i < n; i++ {
+			f.set(i, (i*0x9e3779b97f4a7c15)&max)
+		}
+		f.set(n/2, max)
+		f.set(n/2+1, 0)
+		for i := uint64(0); i < n; i++ {
+			expected := (i * 0x9e3779b97f4a7c15) & max
+			switch i {
+			case n / 2:
+				expected = max
+			case n/2 + 1:
+				expected = 0
+			}
+			if actual := f.get(i); actual != expected {
+				t.Errorf("width %v: get(%v): expected %x, actual %x", width, i, expected, actual)
+			}
+		}
+	}
+}
+
+func TestCuckooFilter(t *testing.T) {
+	var (
+		count     = 100000
+		numItems  = uint64(count)
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	negatives := prepTestCases(count, minStrLen, maxStrLen)
+
+	for _, bucketSize := range []uint8{2, 4, 8} {
+		for _, fp := range []float64{0.01, 0.001} {
+			cf, err := NewCuckooByEstimatesWithHasher(numItems, fp, bucketSize, NewXXHasher(0))
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			for _, tt := range tests {
+				if err := cf.Insert(tt.data); err != nil {
+					t.Errorf("bucket size %v, fp rate %v: Insert(%v): expected nil error, actual %v", bucketSize, fp, string(tt.data), err)
+				}
+			}
+			if cf.Len() != numItems {
+				t.Errorf("Len: expected %v, actual %v", numItems, cf.Len())
+			}
+			for _, tt := range tests {
+				if result := cf.Lookup(tt.data); !result {
+					t.Errorf("Lookup(%v): expected %v, actual %v", string(tt.data), true, false)
+				}
+			}
+
+			fps := 0
+			for _, tt := range negatives {
+				if cf.Lookup(tt.data) {
+					fps++
+				}
+			}
+			if rate := float64(fps) / float64(count); rate > fp*(1+acceptableAdditionalFalsePositiveErrorRate) {
+				t.Errorf("bucket size %v: expected false positive rate close to %v, actual %v", bucketSize, fp, rate)
+			}
+
+			for _, tt := range tests {
+				if !cf.Delete(tt.data) {
+					t.Errorf("Delete(%v): expected %v, actual %v", string(tt.data), true, false)
+				}
+			}
+			if cf.Len() != 0 {
+				t.Errorf("Len: expected %v, actual %v", 0, cf.Len())
+			}
+			for _, w := range cf.slots.words {
+				if w != 0 {
+					t.Errorf("expected every slot to be empty after deleting every element")
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestCuckooFilterCount(t *testing.T) {
+	cf, err := NewCuckooBySizeWithHasher(64, 4, 16, NewXXHasher(0))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	data := []byte("data")
+	for i := uint64(1); i <= 8; i++ {
+		if err := cf.Insert(data); err != nil {
+			t.Errorf("Insert: expected nil error, actual %v", err)
+		}
+		if c := cf.Count(data); c != i {
+			t.Errorf("Count: expected %v, actual %v", i, c)
+		}
+	}
+	// both buckets of data are full of its own fingerprint, so no fingerprint can be moved out of the way
+	before := append([]uint64(nil), cf.slots.words...)
+	if err := cf.Insert(data); err != ErrMaxKicksExceeded {
+		t.Errorf("Insert: expected error %v, actual %v", ErrMaxKicksExceeded, err)
+	}
+	for i := range before {
+		if before[i] != cf.slots.words[i] {
+			t.Errorf("expected a failed Insert to leave the cuckoo filter unchanged")
+			break
+		}
+	}
+	if !cf.Delete(data) || cf.Count(data) != 7 {
+		t.Errorf("Delete: expected Count to be %v afterwards, actual %v", 7, cf.Count(data))
+	}
+	if cf.Delete([]byte("other")) {
+		t.Errorf("Delete: expected %v for an element that was not inserted, actual %v", false, true)
+	}
+}
+
+// Filling a cuckoo filter until Insert fails must reach close to the maximum load factor, whether or not
+// the number of buckets is a power of two, and the failed Insert must leave every inserted element in place.
+func TestCuckooFilterFull(t *testing.T) {
+	var (
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	for _, bucketSize := range []uint8{2, 4, 8} {
+		for _, numBuckets := range []uint64{1024, 1000, 1537} {
+			cf, err := NewCuckooBySizeWithHasher(numBuckets, bucketSize, 16, NewXXHasher(0))
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			tests := prepTestCases(int(numBuckets*uint64(bucketSize)), minStrLen, maxStrLen)
+			inserted := 0
+			for _, tt := range tests {
+				if err := cf.Insert(tt.data); err != nil {
+					if err != ErrMaxKicksExceeded {
+						t.Errorf("Insert: expected error %v, actual %v", ErrMaxKicksExceeded, err)
+					}
+					break
+				}
+				inserted++
+			}
+			if lf := cf.LoadFactor(); lf < cuckooMaxLoadFactor(bucketSize)-0.05 {
+				t.Errorf("%v buckets of %v: expected load factor close to %v, actual %v", numBuckets, bucketSize, cuckooMaxLoadFactor(bucketSize), lf)
+			}
+			for _, tt := range tests[:inserted] {
+				if result := cf.Lookup(tt.data); !result {
+					t.Errorf("Lookup(%v): expected %v, actual %v", string(tt.data), true, false)
+				}
+			}
+		}
+	}
+}
+
+// At low false positive rates, a cuckoo filter must take less space than a BloomFilter structure.
+func TestCuckooFilterSpace(t *testing.T) {
+	// 4 fingerprints per bucket at the maximum load factor of 0.95 fill 2^16 buckets
+	numItems := uint64(249036)
+	for _, fp := range []float64{0.001, 0.0001, 0.00001} {
+		cf, err := NewCuckooByEstimates(numItems, fp, 4, nil, nil)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		bf, err := NewByEstimates(numItems, fp, nil, nil)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if len(cf.slots.words) >= len(bf.bits) {
+			t.Errorf("fp rate %v: expected cuckoo filter to be smaller than %v words, actual %v", fp, len(bf.bits), len(cf.slots.words))
+		}
+	}
+}
+
+func TestCuckooFilterMarshalBinary(t *testing.T) {
+	var (
+		count     = 10000
+		numItems  = uint64(count)
+		fp        = 0.001
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	cf, err := NewCuckooByEstimates(numItems, fp, 4, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		cf.Insert(tt.data)
+	}
+	data, err := cf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var loaded CuckooFilter
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if loaded.Len() != cf.Len() || loaded.numBuckets != cf.numBuckets || loaded.fingerprintBits != cf.fingerprintBits {
+		t.Errorf("expected loaded cuckoo filter to match the original one")
+	}
+	for _, tt := range tests {
+		if result := loaded.Lookup(tt.data); !result {
+			t.Errorf("Lookup(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+	again, _ := loaded.MarshalBinary()
+	if !bytes.Equal(data, again) {
+		t.Errorf("expected loaded cuckoo filter to marshal to the same bytes")
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[cuckooHeaderLen] ^= 1
+	// 1<<59 buckets of 8 fingerprints of 32 bits take 1<<67 bits, which wraps around to no words at all
+	overflowed := append([]byte(nil), data[:cuckooHeaderLen]...)
+	overflowed[5], overflowed[6] = 8, 32
+	binary.LittleEndian.PutUint64(overflowed[8:16], 1<<59)
+	overflowed = binary.LittleEndian.AppendUint32(overflowed, crc32.Checksum(overflowed, castagnoli))
+	versioned := append([]byte(nil), data...)
+	versioned[4] = 99
+	errorTests := []struct {
+		description string
+		data        []byte
+		err         error
+	}{
+		{"empty", nil, ErrInvalidEncoding},
+		{"truncated", data[:len(data)-1], ErrInvalidEncoding},
+		{"magic", append([]byte("BLMF"), data[4:]...), ErrInvalidEncoding},
+		{"version", versioned, ErrUnsupportedVersion},
+		{"checksum", corrupted, ErrChecksumMismatch},
+		{"size overflow", overflowed, ErrInvalidEncoding},
+	}
+	for _, tt := range errorTests {
+		var cf CuckooFilter
+		if err := cf.UnmarshalBinary(tt.data); err != tt.err {
+			t.Errorf("%v: expected error %v, actual %v", tt.description, tt.err, err)
+		}
+	}
+
+	other, err := NewCuckooBySize(1, 4, 8, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if err := other.UnmarshalBinary(data); err != ErrHashSchemeMismatch {
+		t.Errorf("expected error %v, actual %v", ErrHashSchemeMismatch, err)
+	}
+}
+
+// This test should NOT fail when "go test -race" command is issued.
+// CuckooFilterTS structure is thread safe.
+func TestCuckooFilterTSParallel(t *testing.T) {
+	var (
+		count      = 10000
+		numItems   = uint64(count)
+		fp         = 0.01
+		maxStrLen  = 50
+		minStrLen  = 20
+		goroutines = 4
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	cfts, err := NewTSCuckooByEstimates(numItems, fp, 4, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < count; i += goroutines {
+				if err := cfts.Insert(tests[i].data); err != nil {
+					t.Errorf("Insert: expected nil error, actual %v", err)
+				}
+				cfts.Lookup(tests[(i+1)%count].data)
+				cfts.Count(tests[i].data)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if cfts.Len() != numItems {
+		t.Errorf("Len: expected %v, actual %v", numItems, cfts.Len())
+	}
+	data, err := cfts.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	var loaded CuckooFilterTS
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		if result := loaded.Lookup(tt.data); !result {
+			t.Errorf("Lookup(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+		if !loaded.Delete(tt.data) {
+			t.Errorf("Delete(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math/bits"
+)
+
+// A serialized BloomFilter has the following layout, all integers being little endian:
+//
+//	offset  length  field
+//	0       4       magic "BLMF"
+//	4       1       format version
+//	5       1       number of hash functions
+//	6       2       reserved, zero
+//	8       8       size in bits
+//	16      8       hash scheme identifier
+//	24      8       number of Add calls
+//	32      8       estimated number of items
+//	40      8*n     bits, n = ceil(size / 64)
+//	40+8*n  4       CRC-32C of all preceding bytes
+//
+// The header is a multiple of 8 bytes long so that the bits stay word aligned.
+// Version 1 had a 32 byte header, with a reserved field instead of the number of Add calls and
+// without the estimated number of items. It can still be read.
+const (
+	encodingMagic   = "BLMF"
+	encodingVersion = 2
+	headerLenV1     = 32
+	headerLen       = 40
+	checksumLen     = 4
+
+	// streamChunkLen is the number of bytes of the bit array that WriteTo and ReadFrom hold in memory at once.
+	streamChunkLen = 64 * 1024
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// hashSchemeProbe is fed to both hash functions of a bloom filter and the results identify
+// the hash scheme that the bloom filter was built with.
+var hashSchemeProbe = []byte("github.com/mraufc/bloomfilter")
+
+// hashScheme returns an identifier for the hash functions of Hasher h.
+// Two hashers that place elements at the same bit locations have the same identifier.
+func hashScheme(h Hasher) uint64 {
+	hash1Val, hash2Val := h.Sum128(hashSchemeProbe)
+
+	return hash1Val ^ bits.RotateLeft64(hash2Val, 32)
+}
+
+type header struct {
+	version          uint8
+	numHashFunctions uint8
+	size             uint64
+	hashScheme       uint64
+	count            uint64
+	capacity         uint64
+}
+
+func (bf *BloomFilter) header() header {
+	return header{
+		version:          encodingVersion,
+		numHashFunctions: bf.numHashFunctions,
+		size:             bf.size,
+		hashScheme:       bf.hashScheme,
+		count:            bf.count,
+		capacity:         bf.capacity,
+	}
+}
+
+// headerLenOf returns the length of the header of the given version, which is the first headerLenV1 bytes of b.
+func headerLenOf(b []byte) int {
+	if b[4] == 1 {
+		return headerLenV1
+	}
+	return headerLen
+}
+
+func (h header) put(b []byte) {
+	copy(b[0:4], encodingMagic)
+	b[4] = h.version
+	b[5] = h.numHashFunctions
+	binary.LittleEndian.PutUint16(b[6:8], 0)
+	binary.LittleEndian.PutUint64(b[8:16], h.size)
+	binary.LittleEndian.PutUint64(b[16:24], h.hashScheme)
+	binary.LittleEndian.PutUint64(b[24:32], h.count)
+	binary.LittleEndian.PutUint64(b[32:40], h.capacity)
+}
+
+func parseHeader(b []byte) (header, error) {
+	var h header
+	if len(b) < headerLenV1 || string(b[0:4]) != encodingMagic {
+		return h, ErrInvalidEncoding
+	}
+	h.version = b[4]
+	if h.version != 1 && h.version != encodingVersion {
+		return h, ErrUnsupportedVersion
+	}
+	if len(b) < headerLenOf(b) {
+		return h, ErrInvalidEncoding
+	}
+	h.numHashFunctions = b[5]
+	h.size = binary.LittleEndian.Uint64(b[8:16])
+	h.hashScheme = binary.LittleEndian.Uint64(b[16:24])
+	if h.size == 0 {
+		return h, ErrInvalidSize
+	}
+	if h.numHashFunctions == 0 {
+		return h, ErrInvalidNumberOfHashFunctions
+	}
+	if h.size > MaxSize {
+		return h, ErrInvalidEncoding
+	}
+	if h.version == 1 {
+		h.capacity = capacityOf(h.size, h.numHashFunctions)
+	} else {
+		h.count = binary.LittleEndian.Uint64(b[24:32])
+		h.capacity = binary.LittleEndian.Uint64(b[32:40])
+	}
+
+	return h, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The returned byte slice holds the size, number of hash functions, an identifier of the hash functions,
+// the statistics returned by Stats and the bit array of the BloomFilter structure, followed by a checksum.
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, headerLen+8*len(bf.bits)+checksumLen))
+	if _, err := bf.WriteTo(buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// The hash functions of the receiver are kept, and when the receiver has none, default hash functions are used.
+// ErrHashSchemeMismatch is returned when data was produced by a BloomFilter with different hash functions.
+func (bf *BloomFilter) UnmarshalBinary(data []byte) error {
+	h, err := parseHeader(data)
+	if err != nil {
+		return err
+	}
+	l := headerLenOf(data)
+	if len(data) < l+checksumLen || uint64(len(data)-l-checksumLen) != 8*numWords(h.size) {
+		return ErrInvalidEncoding
+	}
+
+	_, err = bf.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo implements io.WriterTo.
+// It writes the same encoding as MarshalBinary to w, streaming the bit array in chunks
+// instead of building the whole encoding in memory.
+func (bf *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	crc := crc32.New(castagnoli)
+	mw := io.MultiWriter(w, crc)
+
+	buf := make([]byte, streamChunkLen)
+	bf.header().put(buf)
+	m, err := mw.Write(buf[:headerLen])
+	n += int64(m)
+	if err != nil {
+		return n, err
+	}
+
+	for i := 0; i < len(bf.bits); i += streamChunkLen / 8 {
+		chunk := bf.bits[i:]
+		if len(chunk) > streamChunkLen/8 {
+			chunk = chunk[:streamChunkLen/8]
+		}
+		for j, word := range chunk {
+			binary.LittleEndian.PutUint64(buf[8*j:], word)
+		}
+		m, err = mw.Write(buf[:8*len(chunk)])
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	binary.LittleEndian.PutUint32(buf, crc.Sum32())
+	m, err = w.Write(buf[:checksumLen])
+	n += int64(m)
+
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom.
+// It reads an encoding written by WriteTo or MarshalBinary from r, stopping right after the checksum.
+// The bit array is allocated only once, at the size in the header. When r is an io.Seeker, such as an *os.File,
+// a header which claims more bits than are left in r fails with ErrInvalidEncoding before anything is allocated;
+// other readers are trusted to hold as many bits as their header claims.
+// The receiver is modified only when the whole encoding was read and verified.
+// The hash functions of the receiver are kept, and when the receiver has none, default hash functions are used.
+func (bf *BloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	crc := crc32.New(castagnoli)
+	tr := io.TeeReader(r, crc)
+
+	buf := make([]byte, streamChunkLen)
+	m, err := io.ReadFull(tr, buf[:headerLenV1])
+	n += int64(m)
+	if err != nil {
+		return n, readError(err)
+	}
+	if l := headerLenOf(buf); l > headerLenV1 {
+		m, err = io.ReadFull(tr, buf[headerLenV1:l])
+		n += int64(m)
+		if err != nil {
+			return n, readError(err)
+		}
+	}
+	h, err := parseHeader(buf[:headerLenOf(buf)])
+	if err != nil {
+		return n, err
+	}
+
+	hr, scheme := bf.hasher, bf.hashScheme
+	if hr == nil {
+		hr = fnvHasher{}
+		scheme = hashScheme(hr)
+	}
+	if scheme != h.hashScheme {
+		return n, ErrHashSchemeMismatch
+	}
+
+	l := numWords(h.size)
+	if left, ok := remaining(r); ok && left < 8*l+checksumLen {
+		return n, ErrInvalidEncoding
+	}
+	bits := make([]uint64, l)
+	for i := 0; i < len(bits); i += streamChunkLen / 8 {
+		chunk := bits[i:]
+		if len(chunk) > streamChunkLen/8 {
+			chunk = chunk[:streamChunkLen/8]
+		}
+		m, err = io.ReadFull(tr, buf[:8*len(chunk)])
+		n += int64(m)
+		if err != nil {
+			return n, readError(err)
+		}
+		for j := range chunk {
+			chunk[j] = binary.LittleEndian.Uint64(buf[8*j:])
+		}
+	}
+
+	sum := crc.Sum32()
+	m, err = io.ReadFull(r, buf[:checksumLen])
+	n += int64(m)
+	if err != nil {
+		return n, readError(err)
+	}
+	if binary.LittleEndian.Uint32(buf) != sum {
+		return n, ErrChecksumMismatch
+	}
+
+	bf.hasher = hr
+	bf.hashScheme = scheme
+	bf.numHashFunctions = h.numHashFunctions
+	bf.size = h.size
+	bf.bits = bits
+	bf.bitsSet = bf.popcount()
+	bf.count = h.count
+	bf.capacity = h.capacity
+	bf.thresholdFired = false
+
+	return n, nil
+}
+
+// remaining returns the number of bytes left in r when r is an io.Seeker whose position and end can be found,
+// and false otherwise, for example for pipes.
+func remaining(r io.Reader) (uint64, bool) {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return 0, false
+	}
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil || end < cur {
+		return 0, false
+	}
+	return uint64(end - cur), true
+}
+
+// readError reports a stream that ended before the encoding was complete as ErrInvalidEncoding.
+func readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalidEncoding
+	}
+	return err
+}
+
+// NewFromReader reads a BloomFilter structure written by WriteTo or MarshalBinary from r.
+// hash.Hash64 hash1 and hash.Hash64 hash2 must be the hash functions that the BloomFilter was built with,
+// and when they are nil, a default hash.Hash64 for each will be used.
+func NewFromReader(r io.Reader, hash1 hash.Hash64, hash2 hash.Hash64) (*BloomFilter, error) {
+	h := hasherOf(hash1, hash2)
+	bf := BloomFilter{
+		hasher:     h,
+		hashScheme: hashScheme(h),
+	}
+	if _, err := bf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return &bf, nil
+}
+
+// NewTSFromReader returns a new BloomFilterTS structure. For more details, please see NewFromReader function.
+func NewTSFromReader(r io.Reader, hash1 hash.Hash64, hash2 hash.Hash64) (*BloomFilterTS, error) {
+	bf, err := NewFromReader(r, hash1, hash2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BloomFilterTS{bf: bf}, nil
+}
+
+// MarshalBinary for thread safe BloomFilterTS structure serves the same purpose as MarshalBinary for BloomFilter structure.
+func (bfts *BloomFilterTS) MarshalBinary() ([]byte, error) {
+	bfts.mtx.RLock()
+	defer bfts.mtx.RUnlock()
+	return bfts.bf.MarshalBinary()
+}
+
+// UnmarshalBinary for thread safe BloomFilterTS structure serves the same purpose as UnmarshalBinary for BloomFilter structure.
+func (bfts *BloomFilterTS) UnmarshalBinary(data []byte) error {
+	bfts.mtx.Lock()
+	defer bfts.mtx.Unlock()
+	if bfts.bf == nil {
+		bfts.bf = &BloomFilter{}
+	}
+	return bfts.bf.UnmarshalBinary(data)
+}
+
+// WriteTo for thread safe BloomFilterTS structure serves the same purpose as WriteTo for BloomFilter structure.
+func (bfts *BloomFilterTS) WriteTo(w io.Writer) (int64, error) {
+	bfts.mtx.RLock()
+	defer bfts.mtx.RUnlock()
+	return bfts.bf.WriteTo(w)
+}
+
+// ReadFrom for thread safe BloomFilterTS structure serves the same purpose as ReadFrom for BloomFilter structure.
+func (bfts *BloomFilterTS) ReadFrom(r io.Reader) (int64, error) {
+	bfts.mtx.Lock()
+	defer bfts.mtx.Unlock()
+	if bfts.bf == nil {
+		bfts.bf = &BloomFilter{}
+	}
+	return bfts.bf.ReadFrom(r)
+}
@@ -0,0 +1,379 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"testing"
+)
+
+func TestBloomFilterMarshalBinary(t *testing.T) {
+	var (
+		count     = 10000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	bf, err := NewByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		bf.Add(tt.data)
+	}
+
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var loaded BloomFilter
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if loaded.size != bf.size || loaded.numHashFunctions != bf.numHashFunctions {
+		t.Errorf("expected size %v and %v hash functions, actual size %v and %v hash functions", bf.size, bf.numHashFunctions, loaded.size, loaded.numHashFunctions)
+	}
+	for _, tt := range tests {
+		if result := loaded.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+
+	bfts, err := NewTSBySizeAndNumHashFuncs(1, 1, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if err := bfts.UnmarshalBinary(data); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	dataTS, err := bfts.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if string(dataTS) != string(data) {
+		t.Errorf("expected BloomFilterTS to marshal to the same bytes as BloomFilter")
+	}
+}
+
+func TestBloomFilterUnmarshalBinaryErrors(t *testing.T) {
+	bf, err := NewBySizeAndNumHashFuncs(1000, 3, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bf.Add([]byte("data"))
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	corrupt := func(i int, b byte) []byte {
+		c := append([]byte(nil), data...)
+		c[i] = b
+		return c
+	}
+
+	tests := []struct {
+		description string
+		data        []byte
+		err         error
+	}{
+		{"empty", nil, ErrInvalidEncoding},
+		{"bad magic", corrupt(0, 'X'), ErrInvalidEncoding},
+		{"unknown version", corrupt(4, encodingVersion+1), ErrUnsupportedVersion},
+		{"zero hash functions", corrupt(5, 0), ErrInvalidNumberOfHashFunctions},
+		{"truncated", data[:len(data)-1], ErrInvalidEncoding},
+		{"extra bytes", append(append([]byte(nil), data...), 0), ErrInvalidEncoding},
+		{"corrupted bits", corrupt(headerLen, data[headerLen]^0xff), ErrChecksumMismatch},
+		{"corrupted checksum", corrupt(len(data)-1, data[len(data)-1]^0xff), ErrChecksumMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			var loaded BloomFilter
+			if err := loaded.UnmarshalBinary(tt.data); err != tt.err {
+				t.Errorf("expected error %v, actual %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestBloomFilterUnmarshalBinaryHashSchemeMismatch(t *testing.T) {
+	table := crc64.MakeTable(crc64.ISO)
+
+	bf, err := NewBySizeAndNumHashFuncs(1000, 3, crc64.New(table), nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var loaded BloomFilter
+	if err := loaded.UnmarshalBinary(data); err != ErrHashSchemeMismatch {
+		t.Errorf("expected error %v, actual %v", ErrHashSchemeMismatch, err)
+	}
+
+	same, err := NewBySizeAndNumHashFuncs(1, 1, crc64.New(table), nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if err := same.UnmarshalBinary(data); err != nil {
+		t.Errorf("expected nil error, actual %v", err)
+	}
+}
+
+func TestBloomFilterWriteToReadFrom(t *testing.T) {
+	var (
+		count     = 10000
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	// the bit array spans several stream chunks
+	bf, err := NewBySizeAndNumHashFuncs(8*streamChunkLen*3+5, 7, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		bf.Add(tt.data)
+	}
+
+	var buf bytes.Buffer
+	n, err := bf.WriteTo(&buf)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("expected WriteTo to report %v bytes, actual %v", buf.Len(), n)
+	}
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("expected WriteTo and MarshalBinary to produce the same bytes")
+	}
+
+	// trailing data after the encoding must be left in the reader
+	buf.WriteString("trailing")
+	loaded, err := NewFromReader(&buf, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if buf.String() != "trailing" {
+		t.Errorf("expected ReadFrom to stop after the checksum, remaining %q", buf.String())
+	}
+	for _, tt := range tests {
+		if result := loaded.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+
+	var bfts BloomFilterTS
+	n, err = bfts.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if n != int64(len(data)) {
+		t.Errorf("expected ReadFrom to report %v bytes, actual %v", len(data), n)
+	}
+	buf.Reset()
+	if _, err := bfts.WriteTo(&buf); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("expected BloomFilterTS to write the same bytes as BloomFilter")
+	}
+}
+
+func TestBloomFilterReadFromErrors(t *testing.T) {
+	bf, err := NewBySizeAndNumHashFuncs(8*streamChunkLen+1, 3, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bf.Add([]byte("data"))
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	for _, l := range []int{0, headerLen - 1, headerLen, headerLen + streamChunkLen, len(data) - 1} {
+		if _, err := NewFromReader(bytes.NewReader(data[:l]), nil, nil); err != ErrInvalidEncoding {
+			t.Errorf("expected error %v for %v bytes, actual %v", ErrInvalidEncoding, l, err)
+		}
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[headerLen+streamChunkLen] ^= 0xff
+	loaded, err := NewBySizeAndNumHashFuncs(10, 1, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if _, err := loaded.ReadFrom(bytes.NewReader(corrupted)); err != ErrChecksumMismatch {
+		t.Errorf("expected error %v, actual %v", ErrChecksumMismatch, err)
+	}
+	if loaded.size != 10 || loaded.numHashFunctions != 1 {
+		t.Errorf("expected a failed ReadFrom to leave the bloom filter unchanged")
+	}
+}
+
+// A header must not make ReadFrom allocate more than the stream holds.
+func TestBloomFilterReadFromMalformedHeader(t *testing.T) {
+	encode := func(size uint64, numHashFunctions uint8) []byte {
+		b := make([]byte, headerLen)
+		header{
+			version:          encodingVersion,
+			numHashFunctions: numHashFunctions,
+			size:             size,
+			hashScheme:       hashScheme(fnvHasher{}),
+		}.put(b)
+		return b
+	}
+
+	tests := []struct {
+		description string
+		data        []byte
+	}{
+		{"size of 1<<62 without bits", encode(1<<62, 3)},
+		{"size of MaxSize without bits", encode(MaxSize, 3)},
+		{"size over MaxSize", encode(MaxSize+1, 3)},
+	}
+	for _, tt := range tests {
+		if bf, err := NewFromReader(bytes.NewReader(tt.data), nil, nil); bf != nil || err != ErrInvalidEncoding {
+			t.Errorf("%v: expected nil bloom filter and error %v, actual %v and %v", tt.description, ErrInvalidEncoding, bf, err)
+		}
+		var loaded BloomFilter
+		if err := loaded.UnmarshalBinary(tt.data); err != ErrInvalidEncoding {
+			t.Errorf("%v: expected error %v, actual %v", tt.description, ErrInvalidEncoding, err)
+		}
+	}
+
+	// a reader that is not an io.Seeker is read until it ends
+	r := io.MultiReader(bytes.NewReader(encode(1<<20, 3)), bytes.NewReader(make([]byte, 100)))
+	if bf, err := NewFromReader(r, nil, nil); bf != nil || err != ErrInvalidEncoding {
+		t.Errorf("truncated stream: expected nil bloom filter and error %v, actual %v and %v", ErrInvalidEncoding, bf, err)
+	}
+}
+
+// Filters that are no larger than their number of hash functions must be decoded like any other.
+func TestBloomFilterMarshalBinaryTiny(t *testing.T) {
+	plan, err := PlanSize(1, 0, 0.5)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	planned, err := NewFromPlan(plan, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bySize, err := NewBySizeAndNumHashFuncs(3, 3, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	byEstimates, err := NewByEstimates(1, 0.5, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	for _, bf := range []*BloomFilter{planned, bySize, byEstimates} {
+		bf.Add([]byte("data"))
+		data, err := bf.MarshalBinary()
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		var loaded BloomFilter
+		if err := loaded.UnmarshalBinary(data); err != nil {
+			t.Errorf("size %v with %v hash functions: expected nil error, actual %v", bf.size, bf.numHashFunctions, err)
+			continue
+		}
+		if loaded.size != bf.size || loaded.numHashFunctions != bf.numHashFunctions || !loaded.Query([]byte("data")) {
+			t.Errorf("expected size %v and %v hash functions, actual size %v and %v hash functions", bf.size, bf.numHashFunctions, loaded.size, loaded.numHashFunctions)
+		}
+	}
+}
+
+func TestBloomFilterUnmarshalBinaryVersion1(t *testing.T) {
+	bf, err := NewByEstimates(1000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bf.Add([]byte("data"))
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	// version 1 has a 32 byte header with a reserved field in place of the number of Add calls
+	v1 := append([]byte(nil), data[:headerLenV1]...)
+	v1[4] = 1
+	for i := 24; i < headerLenV1; i++ {
+		v1[i] = 0
+	}
+	v1 = append(v1, data[headerLen:len(data)-checksumLen]...)
+	v1 = binary.LittleEndian.AppendUint32(v1, crc32.Checksum(v1, castagnoli))
+
+	var loaded BloomFilter
+	if err := loaded.UnmarshalBinary(v1); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if result := loaded.Query([]byte("data")); !result {
+		t.Errorf("Query(%v): expected %v, actual %v", "data", true, false)
+	}
+	stats := loaded.Stats()
+	if stats.Count != 0 || stats.Capacity != capacityOf(bf.size, bf.numHashFunctions) || stats.BitsSet != bf.bitsSet {
+		t.Errorf("unexpected statistics %+v for a version 1 encoding", stats)
+	}
+
+	loaded2, err := NewFromReader(bytes.NewReader(v1), nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if stats2 := loaded2.Stats(); stats2 != stats {
+		t.Errorf("expected ReadFrom and UnmarshalBinary to load the same statistics, actual %+v and %+v", stats2, stats)
+	}
+
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if stats := loaded.Stats(); stats != bf.Stats() {
+		t.Errorf("expected statistics %+v, actual %+v", bf.Stats(), stats)
+	}
+}
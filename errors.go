@@ -17,4 +17,87 @@ var (
 
 	// ErrInvalidNumberOfHashFunctions is returned when number of hash functions is not positive
 	ErrInvalidNumberOfHashFunctions = errors.New("number of hash functions should be positive")
-)
\ No newline at end of file
+
+	// ErrTooManyHashFunctions is returned when the ideal number of hash functions for the estimated false positive rate
+	// is more than MaxHashFunctions, which happens for false positive rates below about 2^-255
+	ErrTooManyHashFunctions = errors.New("false positive rate requires more hash functions than MaxHashFunctions")
+
+	// ErrSizeOverflow is returned when the size in bits of a bloom filter, given or calculated from estimated number
+	// of items and estimated false positive rate, is more than MaxSize
+	ErrSizeOverflow = errors.New("size of bloom filter is more than MaxSize bits")
+
+	// ErrInvalidEncoding is returned when a serialized bloom filter is malformed or truncated
+	ErrInvalidEncoding = errors.New("invalid bloom filter encoding")
+
+	// ErrUnsupportedVersion is returned when a serialized bloom filter has an unknown format version
+	ErrUnsupportedVersion = errors.New("unsupported bloom filter encoding version")
+
+	// ErrChecksumMismatch is returned when the checksum of a serialized bloom filter does not match its contents
+	ErrChecksumMismatch = errors.New("bloom filter checksum mismatch")
+
+	// ErrHashSchemeMismatch is returned when a serialized bloom filter was built with different hash functions
+	// than the ones it is being loaded with
+	ErrHashSchemeMismatch = errors.New("bloom filter was built with different hash functions")
+
+	// ErrInvalidCounterWidth is returned when the counter width of a counting bloom filter is neither 4 nor 8 bits
+	ErrInvalidCounterWidth = errors.New("counter width must be 4 or 8 bits")
+
+	// ErrCounterUnderflow is returned when removing an element from a counting bloom filter would decrement
+	// a counter below zero, meaning that the element was never added
+	ErrCounterUnderflow = errors.New("element was not added to the counting bloom filter")
+
+	// ErrInvalidTighteningRatio is returned when the tightening ratio of a scalable bloom filter is not greater than 0.0
+	// or less than 1.0
+	ErrInvalidTighteningRatio = errors.New("tightening ratio must be in range of (0.0, 1.0)")
+
+	// ErrIncompatibleFilters is returned when two bloom filters that differ in size, number of hash functions
+	// or hash functions are combined
+	ErrIncompatibleFilters = errors.New("bloom filters must have the same size, number of hash functions and hash functions")
+
+	// ErrInvalidBucketSize is returned when the bucket size of a cuckoo filter is not 2, 4 or 8
+	ErrInvalidBucketSize = errors.New("bucket size must be 2, 4 or 8")
+
+	// ErrInvalidFingerprintBits is returned when the number of bits of a fingerprint of a cuckoo filter
+	// is not in range of [1, 32], or the number of bits of a fingerprint of a binary fuse filter is neither 8 nor 16
+	ErrInvalidFingerprintBits = errors.New("unsupported number of bits of a fingerprint")
+
+	// ErrMaxKicksExceeded is returned when an element can not be inserted into a cuckoo filter within MaxKicks moves
+	// of other fingerprints, which means that the cuckoo filter is nearly full
+	ErrMaxKicksExceeded = errors.New("cuckoo filter is full: maximum number of kicks exceeded")
+
+	// ErrBuildFailed is returned when a binary fuse filter could not be built from its keys with any of
+	// MaxBuildAttempts seeds
+	ErrBuildFailed = errors.New("binary fuse filter could not be built")
+
+	// ErrConflictingOptions is returned when New is given options that exclude each other, such as WithEstimates
+	// and WithSize, or WithHasher and WithSeed, or a WithSize that does not fit in WithMemoryBudget
+	ErrConflictingOptions = errors.New("conflicting bloom filter options")
+
+	// ErrUnmappable is returned when the bit array of a bloom filter file can not be mapped into memory as it is,
+	// because it is not aligned to 8 bytes in the file or the CPU is big endian
+	ErrUnmappable = errors.New("bloom filter file can not be mapped into memory")
+
+	// ErrReadOnlyMapping is returned, or panicked with, when an element is added to a bloom filter file that is mapped
+	// into memory with MapReadOnly
+	ErrReadOnlyMapping = errors.New("bloom filter file is mapped read only")
+
+	// ErrFileTruncated is returned, or panicked with, when a bloom filter file that is mapped into memory was truncated
+	// by another process, so that its bits can no longer be accessed
+	ErrFileTruncated = errors.New("bloom filter file was truncated while mapped")
+
+	// ErrInfeasiblePlan is returned when no bloom filter satisfies the numbers given to a PlanX function
+	ErrInfeasiblePlan = errors.New("no bloom filter satisfies the plan")
+
+	// ErrInvalidThreadSafety is returned when New is given a ThreadSafety mode that is not defined
+	ErrInvalidThreadSafety = errors.New("unknown thread safety mode")
+
+	// ErrInvalidNumberOfShards is returned when the number of shards of a sharded bloom filter is not positive
+	ErrInvalidNumberOfShards = errors.New("number of shards should be positive")
+
+	// ErrInvalidWindow is returned when the window or granularity of a sliding window bloom filter is not positive,
+	// the granularity is longer than the window, or the window needs more than MaxGenerations generations
+	ErrInvalidWindow = errors.New("granularity must be in range of (0, window] and window must fit in MaxGenerations generations")
+
+	// ErrInvalidCellWidth is returned when the cell width of a stable bloom filter is not 1, 2, 4 or 8 bits
+	ErrInvalidCellWidth = errors.New("cell width must be 1, 2, 4 or 8 bits")
+)
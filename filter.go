@@ -0,0 +1,72 @@
+package bloomfilter
+
+import (
+	"encoding"
+)
+
+// Filter is an approximate set membership data structure that elements can be added to and tested for.
+// Query may return true for an element that was never added, but always returns true for an element that was added.
+type Filter interface {
+	// Add adds the byte slice input to the filter.
+	Add(data []byte)
+
+	// Query tests the byte slice input's existence in the filter.
+	Query(data []byte) bool
+}
+
+// Remover is a Filter that elements can be removed from.
+type Remover interface {
+	Filter
+
+	// Remove removes the byte slice input from the filter. Removing an element that was never added
+	// returns an error, since it may also remove other elements.
+	Remove(data []byte) error
+}
+
+// Merger is a Filter that the elements of another filter of the same kind can be added to at once.
+type Merger interface {
+	Filter
+
+	// Merge adds every element of other to the filter, after which Query returns true for every element
+	// that was added to either of them. ErrIncompatibleFilters is returned when other is not a filter of the same kind,
+	// size and hash functions.
+	Merge(other Filter) error
+}
+
+// Counter is a Filter that estimates how many distinct elements were added to it.
+type Counter interface {
+	Filter
+
+	// EstimatedCount returns the approximate number of distinct elements that were added to the filter.
+	EstimatedCount() uint64
+}
+
+// Serializer is a Filter that can be saved and loaded later.
+type Serializer interface {
+	Filter
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+var (
+	_ Merger     = (*BloomFilter)(nil)
+	_ Counter    = (*BloomFilter)(nil)
+	_ Serializer = (*BloomFilter)(nil)
+
+	_ Merger     = (*BloomFilterTS)(nil)
+	_ Counter    = (*BloomFilterTS)(nil)
+	_ Serializer = (*BloomFilterTS)(nil)
+
+	_ Merger  = (*ShardedBloomFilter)(nil)
+	_ Counter = (*ShardedBloomFilter)(nil)
+
+	_ Filter     = (*AtomicBloomFilter)(nil)
+	_ Filter     = (*BlockedBloomFilter)(nil)
+	_ Remover    = (*CountingBloomFilter)(nil)
+	_ Serializer = (*ScalableBloomFilter)(nil)
+	_ Serializer = (*ScalableBloomFilterTS)(nil)
+	_ Serializer = (*SplitBlockBloomFilter)(nil)
+	_ Filter     = (*SlidingWindowBloomFilter)(nil)
+	_ Filter     = (*SlidingWindowBloomFilterTS)(nil)
+	_ Filter     = (*StableBloomFilter)(nil)
+)
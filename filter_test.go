@@ -0,0 +1,220 @@
+package bloomfilter
+
+import (
+	"hash/crc64"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+const (
+	// conformanceNumItems and conformanceFPRate are the estimates that filters under testFilter are created with.
+	conformanceNumItems = 10000
+	conformanceFPRate   = 0.01
+)
+
+// testFilter runs the conformance tests of Filter, and of Remover, Merger, Counter and Serializer when implemented,
+// against filters returned by newFilter, which must be empty and created for conformanceNumItems items with
+// a false positive rate of conformanceFPRate. Every filter type in the package runs it in TestFilterConformance.
+func testFilter(t *testing.T, newFilter func() (Filter, error)) {
+	var (
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	mustNew := func(t *testing.T) Filter {
+		f, err := newFilter()
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		return f
+	}
+	tests := prepTestCases(conformanceNumItems, minStrLen, maxStrLen)
+	negatives := prepTestCases(conformanceNumItems, minStrLen, maxStrLen)
+
+	t.Run("Filter", func(t *testing.T) {
+		f := mustNew(t)
+		for _, tt := range tests {
+			f.Add(tt.data)
+		}
+		for _, tt := range tests {
+			if result := f.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+		}
+
+		fps := 0
+		for _, tt := range negatives {
+			if f.Query(tt.data) {
+				fps++
+			}
+		}
+		if rate := float64(fps) / float64(len(negatives)); rate > conformanceFPRate*(1+acceptableAdditionalFalsePositiveErrorRate) {
+			t.Errorf("expected false positive rate close to %v, actual %v", conformanceFPRate, rate)
+		}
+	})
+
+	if _, ok := mustNew(t).(Remover); ok {
+		t.Run("Remover", func(t *testing.T) {
+			r := mustNew(t).(Remover)
+			for _, tt := range tests {
+				r.Add(tt.data)
+			}
+			for _, tt := range tests {
+				if err := r.Remove(tt.data); err != nil {
+					t.Errorf("Remove(%v): expected nil error, actual %v", string(tt.data), err)
+				}
+			}
+			for _, tt := range tests {
+				if result := r.Query(tt.data); result {
+					t.Errorf("Query(%v) after Remove: expected %v, actual %v", string(tt.data), false, true)
+				}
+			}
+			if err := r.Remove(tests[0].data); err == nil {
+				t.Errorf("Remove(%v) from an empty filter: expected an error, actual nil", string(tests[0].data))
+			}
+		})
+	}
+
+	if _, ok := mustNew(t).(Merger); ok {
+		t.Run("Merger", func(t *testing.T) {
+			a, b := mustNew(t).(Merger), mustNew(t)
+			for i, tt := range tests {
+				if i%2 == 0 {
+					a.Add(tt.data)
+				} else {
+					b.Add(tt.data)
+				}
+			}
+			if err := a.Merge(b); err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			for _, tt := range tests {
+				if result := a.Query(tt.data); !result {
+					t.Errorf("Query(%v) after Merge: expected %v, actual %v", string(tt.data), true, false)
+				}
+			}
+			if err := a.Merge(mapFilter{}); err != ErrIncompatibleFilters {
+				t.Errorf("Merge of a different kind of filter: expected error %v, actual %v", ErrIncompatibleFilters, err)
+			}
+		})
+	}
+
+	if _, ok := mustNew(t).(Counter); ok {
+		t.Run("Counter", func(t *testing.T) {
+			c := mustNew(t).(Counter)
+			if count := c.EstimatedCount(); count != 0 {
+				t.Errorf("EstimatedCount of an empty filter: expected 0, actual %v", count)
+			}
+			for _, tt := range tests {
+				c.Add(tt.data)
+				c.Add(tt.data)
+			}
+			count, expected := float64(c.EstimatedCount()), float64(len(tests))
+			if count < expected*0.95 || count > expected*1.05 {
+				t.Errorf("EstimatedCount: expected about %v, actual %v", expected, count)
+			}
+		})
+	}
+
+	if _, ok := mustNew(t).(Serializer); ok {
+		t.Run("Serializer", func(t *testing.T) {
+			s := mustNew(t).(Serializer)
+			for _, tt := range tests {
+				s.Add(tt.data)
+			}
+			data, err := s.MarshalBinary()
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+
+			loaded := mustNew(t).(Serializer)
+			if err := loaded.UnmarshalBinary(data); err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			for _, tt := range tests {
+				if result := loaded.Query(tt.data); !result {
+					t.Errorf("Query(%v) after UnmarshalBinary: expected %v, actual %v", string(tt.data), true, false)
+				}
+			}
+			for _, tt := range negatives {
+				if expected, result := s.Query(tt.data), loaded.Query(tt.data); result != expected {
+					t.Errorf("Query(%v) after UnmarshalBinary: expected %v, actual %v", string(tt.data), expected, result)
+				}
+			}
+			if err := mustNew(t).(Serializer).UnmarshalBinary(nil); err == nil {
+				t.Errorf("UnmarshalBinary(nil): expected an error, actual nil")
+			}
+		})
+	}
+}
+
+// mapFilter is an exact Filter, which shows that testFilter only depends on the Filter interface.
+type mapFilter map[string]struct{}
+
+func (mf mapFilter) Add(data []byte) {
+	mf[string(data)] = struct{}{}
+}
+
+func (mf mapFilter) Query(data []byte) bool {
+	_, ok := mf[string(data)]
+	return ok
+}
+
+func TestFilterConformance(t *testing.T) {
+	filters := []struct {
+		name      string
+		newFilter func() (Filter, error)
+	}{
+		{"BloomFilter", func() (Filter, error) {
+			return NewByEstimatesWithHasher(conformanceNumItems, conformanceFPRate, NewXXHasher(0))
+		}},
+		{"BloomFilterTS", func() (Filter, error) {
+			return NewTSByEstimatesWithHasher(conformanceNumItems, conformanceFPRate, NewXXHasher(0))
+		}},
+		{"AtomicBloomFilter", func() (Filter, error) {
+			return NewAtomicByEstimatesWithHasher(conformanceNumItems, conformanceFPRate, NewXXHasher(0))
+		}},
+		{"ShardedBloomFilter", func() (Filter, error) {
+			return NewShardedByEstimatesWithHasher(conformanceNumItems, conformanceFPRate, 8, NewXXHasher(0))
+		}},
+		{"BlockedBloomFilter", func() (Filter, error) {
+			return NewBlockedByEstimatesWithHasher(conformanceNumItems, conformanceFPRate, NewXXHasher(0))
+		}},
+		{"CountingBloomFilter", func() (Filter, error) {
+			return NewCountingByEstimates(conformanceNumItems, conformanceFPRate, 4, nil, crc64.New(crc64Table))
+		}},
+		{"ScalableBloomFilter", func() (Filter, error) {
+			return NewScalable(conformanceNumItems/10, conformanceFPRate, 0, 0, nil, crc64.New(crc64Table))
+		}},
+		{"ScalableBloomFilterTS", func() (Filter, error) {
+			return NewTSScalable(conformanceNumItems/10, conformanceFPRate, 0, 0, nil, crc64.New(crc64Table))
+		}},
+		{"SlidingWindowBloomFilter", func() (Filter, error) {
+			return NewSlidingWindow(conformanceNumItems, conformanceFPRate, time.Minute, time.Minute, stoppedClock, nil, crc64.New(crc64Table))
+		}},
+		{"SlidingWindowBloomFilterTS", func() (Filter, error) {
+			return NewTSSlidingWindow(conformanceNumItems, conformanceFPRate, time.Minute, time.Minute, stoppedClock, nil, crc64.New(crc64Table))
+		}},
+		{"StableBloomFilter", func() (Filter, error) {
+			// enough cells that no element of the test is forgotten
+			return NewStable(1<<20, conformanceFPRate, 4, rand.NewSource(1), nil, crc64.New(crc64Table))
+		}},
+		{"SplitBlockBloomFilter", func() (Filter, error) {
+			return NewSplitBlockByEstimates(conformanceNumItems, conformanceFPRate)
+		}},
+		{"mapFilter", func() (Filter, error) {
+			return mapFilter{}, nil
+		}},
+	}
+
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			testFilter(t, tt.newFilter)
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/mraufc/bloomfilter
+
+go 1.23
@@ -0,0 +1,142 @@
+package bloomfilter
+
+import (
+	"hash"
+	"sync"
+)
+
+// Hasher returns two 64-bit hash values of data, or equivalently the two halves of a 128-bit hash value,
+// in a single call. The locations of data in a bloom filter are created from them by double hashing.
+//
+// Unlike hash.Hash64, a Hasher keeps no state between calls: implementations must be safe for concurrent use
+// and must return the same values for the same data every time.
+type Hasher interface {
+	Sum128(data []byte) (uint64, uint64)
+}
+
+const (
+	fnvOffset64 uint64 = 14695981039346656037
+	fnvPrime64  uint64 = 1099511628211
+)
+
+// fnvHasher computes FNV-1a and FNV-1 of data, the same values as the default hash functions
+// defaultHash1 and defaultHash2, without keeping any state.
+type fnvHasher struct{}
+
+func (fnvHasher) Sum128(data []byte) (uint64, uint64) {
+	hash1Val, hash2Val := fnvOffset64, fnvOffset64
+	for _, c := range data {
+		hash1Val ^= uint64(c)
+		hash1Val *= fnvPrime64
+		hash2Val *= fnvPrime64
+		hash2Val ^= uint64(c)
+	}
+	return hash1Val, hash2Val
+}
+
+// NewFNVHasher returns a Hasher that returns the 64-bit FNV-1a and FNV-1 hash values of data.
+// These are the values of the default hash functions, so bloom filters created with this Hasher
+// are compatible with bloom filters created with nil hash functions.
+// FNV-1a and FNV-1 are cheap, but they differ little from each other, which raises the false positive rate;
+// NewXXHasher returns a Hasher that spreads elements more evenly.
+func NewFNVHasher() Hasher {
+	return fnvHasher{}
+}
+
+// poolHasher hashes data with hash functions created by newHash1 and newHash2.
+// Pairs of hash functions are kept in a sync.Pool, so that every call has a pair of its own.
+type poolHasher struct {
+	pool sync.Pool
+}
+
+type hashPair struct {
+	hash1 hash.Hash64
+	hash2 hash.Hash64
+}
+
+func newPoolHasher(newHash1 func() hash.Hash64, newHash2 func() hash.Hash64) *poolHasher {
+	if newHash1 == nil {
+		newHash1 = defaultHash1
+	}
+	if newHash2 == nil {
+		newHash2 = defaultHash2
+	}
+
+	ph := poolHasher{}
+	ph.pool.New = func() interface{} {
+		return &hashPair{hash1: newHash1(), hash2: newHash2()}
+	}
+	return &ph
+}
+
+func (ph *poolHasher) Sum128(data []byte) (uint64, uint64) {
+	p := ph.pool.Get().(*hashPair)
+	p.hash1.Reset()
+	p.hash1.Write(data)
+	p.hash2.Reset()
+	p.hash2.Write(data)
+	hash1Val, hash2Val := p.hash1.Sum64(), p.hash2.Sum64()
+	ph.pool.Put(p)
+
+	return hash1Val, hash2Val
+}
+
+// newHasher returns a Hasher for hash functions created by newHash1 and newHash2.
+// When both are nil, the stateless fnvHasher is returned.
+func newHasher(newHash1 func() hash.Hash64, newHash2 func() hash.Hash64) Hasher {
+	if newHash1 == nil && newHash2 == nil {
+		return fnvHasher{}
+	}
+	return newPoolHasher(newHash1, newHash2)
+}
+
+// NewHash64FactoryHasher returns a Hasher that adapts hash functions created by newHash1 and newHash2.
+// Every concurrent call uses a pair of hash functions of its own, so calls never wait for each other.
+// newHash1 and newHash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewHash64FactoryHasher(newHash1 func() hash.Hash64, newHash2 func() hash.Hash64) Hasher {
+	return newHasher(newHash1, newHash2)
+}
+
+// lockedHasher hashes data with a pair of hash functions that were passed to a constructor as values.
+// hash.Hash64 keeps state between Reset, Write and Sum64 calls, so the pair is used by one call at a time.
+// The hash functions must not be used anywhere else while the lockedHasher is in use.
+type lockedHasher struct {
+	mtx   sync.Mutex
+	hash1 hash.Hash64
+	hash2 hash.Hash64
+}
+
+func (lh *lockedHasher) Sum128(data []byte) (uint64, uint64) {
+	lh.mtx.Lock()
+	defer lh.mtx.Unlock()
+	lh.hash1.Reset()
+	lh.hash1.Write(data)
+	lh.hash2.Reset()
+	lh.hash2.Write(data)
+
+	return lh.hash1.Sum64(), lh.hash2.Sum64()
+}
+
+// hasherOf returns a Hasher for hash functions hash1 and hash2.
+// When both are nil, the stateless fnvHasher is returned, and when only one is nil,
+// a default hash function is used in its place.
+func hasherOf(hash1 hash.Hash64, hash2 hash.Hash64) Hasher {
+	if hash1 == nil && hash2 == nil {
+		return fnvHasher{}
+	}
+	if hash1 == nil {
+		hash1 = defaultHash1()
+	}
+	if hash2 == nil {
+		hash2 = defaultHash2()
+	}
+	return &lockedHasher{hash1: hash1, hash2: hash2}
+}
+
+// NewHash64Hasher returns a Hasher that adapts the pair of hash functions hash1 and hash2, which is how
+// the constructors that take a pair of hash.Hash64 use them. Since hash.Hash64 keeps state between calls,
+// concurrent calls take turns using the pair, and hash1 and hash2 must not be used anywhere else afterwards.
+// hash1 and hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewHash64Hasher(hash1 hash.Hash64, hash2 hash.Hash64) Hasher {
+	return hasherOf(hash1, hash2)
+}
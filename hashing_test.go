@@ -0,0 +1,165 @@
+package bloomfilter
+
+import (
+	"hash"
+	"hash/crc64"
+	"hash/fnv"
+	"testing"
+)
+
+// fnvHasher must produce the same hash values as the default hash functions,
+// so that bloom filters keep placing elements at the same bit locations.
+func TestFNVHasher(t *testing.T) {
+	var (
+		count     = 1000
+		maxStrLen = 50
+		minStrLen = 0
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	hash1, hash2 := fnv.New64a(), fnv.New64()
+	for _, tt := range tests {
+		hash1.Reset()
+		hash1.Write(tt.data)
+		hash2.Reset()
+		hash2.Write(tt.data)
+
+		hash1Val, hash2Val := fnvHasher{}.Sum128(tt.data)
+		if hash1Val != hash1.Sum64() || hash2Val != hash2.Sum64() {
+			t.Errorf("Sum128(%v): expected %x and %x, actual %x and %x", string(tt.data), hash1.Sum64(), hash2.Sum64(), hash1Val, hash2Val)
+		}
+	}
+
+	if hashScheme(fnvHasher{}) != hashScheme(hasherOf(fnv.New64a(), fnv.New64())) {
+		t.Errorf("expected fnvHasher to have the same hash scheme as the default hash functions")
+	}
+}
+
+func TestXXH64(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, tt := range tests {
+		if actual := xxh64([]byte(tt.data), 0); actual != tt.expected {
+			t.Errorf("xxh64(%v): expected %x, actual %x", tt.data, tt.expected, actual)
+		}
+	}
+}
+
+func TestSipHash128(t *testing.T) {
+	// test vector for the empty message and key 00 01 .. 0f from the reference implementation
+	k0, k1 := uint64(0x0706050403020100), uint64(0x0f0e0d0c0b0a0908)
+	hash1Val, hash2Val := sipHash128(k0, k1, nil)
+	if hash1Val != 0xe6a825ba047f81a3 || hash2Val != 0x930255c71472f66d {
+		t.Errorf("sipHash128(): expected %x and %x, actual %x and %x", uint64(0xe6a825ba047f81a3), uint64(0x930255c71472f66d), hash1Val, hash2Val)
+	}
+
+	h1, h2 := NewSipHasher(k0, k1).Sum128([]byte("data"))
+	h3, h4 := NewSipHasher(k0, k1+1).Sum128([]byte("data"))
+	if h1 == h3 || h2 == h4 {
+		t.Errorf("expected SipHash values with different keys to differ")
+	}
+}
+
+func TestHasherConstructors(t *testing.T) {
+	var (
+		count     = 10000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	negatives := prepTestCases(count, minStrLen, maxStrLen)
+
+	// FNV-1a and FNV-1 are too similar for the false positive rate to be close to fp
+	hashers := []struct {
+		description string
+		h           Hasher
+		uniform     bool
+	}{
+		{"nil", nil, false},
+		{"FNV", NewFNVHasher(), false},
+		{"XX", NewXXHasher(42), true},
+		{"Sip", NewSipHasher(1, 2), true},
+		{"Hash64", NewHash64Hasher(fnv.New64a(), crc64.New(crc64Table)), true},
+		{"Hash64Factory", NewHash64FactoryHasher(nil, func() hash.Hash64 { return crc64.New(crc64Table) }), true},
+	}
+	for _, hh := range hashers {
+		t.Run(hh.description, func(t *testing.T) {
+			bf, err := NewByEstimatesWithHasher(numItems, fp, hh.h)
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			abf, err := NewAtomicByEstimatesWithHasher(numItems, fp, hh.h)
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			for _, tt := range tests {
+				bf.Add(tt.data)
+				abf.Add(tt.data)
+			}
+			for _, tt := range tests {
+				if result := bf.Query(tt.data); !result {
+					t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+				}
+			}
+			for i := range bf.bits {
+				if bf.bits[i] != abf.bits[i] {
+					t.Errorf("expected AtomicBloomFilter to set the same bits as BloomFilter")
+					break
+				}
+			}
+			if !hh.uniform {
+				return
+			}
+			fps := 0
+			for _, tt := range negatives {
+				if bf.Query(tt.data) {
+					fps++
+				}
+			}
+			if rate := float64(fps) / float64(count); rate > 2*fp {
+				t.Errorf("expected false positive rate close to %v, actual %v", fp, rate)
+			}
+		})
+	}
+
+	if hashScheme(NewFNVHasher()) != hashScheme(hasherOf(nil, nil)) {
+		t.Errorf("expected NewFNVHasher to have the same hash scheme as the default hash functions")
+	}
+	if hashScheme(NewXXHasher(1)) == hashScheme(NewXXHasher(2)) {
+		t.Errorf("expected XXHashers with different seeds to have different hash schemes")
+	}
+}
+
+func BenchmarkHasher(b *testing.B) {
+	data := make([]byte, 64)
+	hashers := []struct {
+		description string
+		h           Hasher
+	}{
+		{"FNV", NewFNVHasher()},
+		{"XX", NewXXHasher(0)},
+		{"Sip", NewSipHasher(0, 0)},
+		{"Hash64", NewHash64Hasher(fnv.New64a(), fnv.New64())},
+	}
+	for _, hh := range hashers {
+		b.Run(hh.description, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				hh.h.Sum128(data)
+			}
+		})
+	}
+}
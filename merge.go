@@ -0,0 +1,175 @@
+package bloomfilter
+
+import (
+	"unsafe"
+)
+
+// compatible reports whether bf and other have the same size, number of hash functions and hash functions,
+// which is required for combining their bit arrays.
+func (bf *BloomFilter) compatible(other *BloomFilter) bool {
+	return bf.size == other.size &&
+		bf.numHashFunctions == other.numHashFunctions &&
+		bf.hashScheme == other.hashScheme
+}
+
+// Union adds every element of other to the BloomFilter structure by OR'ing their bit arrays.
+// Afterwards, Query returns true for every element that was added to either of them.
+// ErrIncompatibleFilters is returned when the two BloomFilter structures differ in size, number of hash functions
+// or hash functions.
+func (bf *BloomFilter) Union(other *BloomFilter) error {
+	if !bf.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	for i := range bf.bits {
+		bf.bits[i] |= other.bits[i]
+	}
+	bf.bitsSet = bf.popcount()
+	bf.count += other.count
+	return nil
+}
+
+// Intersect AND's the bit array of the BloomFilter structure with the bit array of other.
+// Afterwards, Query returns true for every element that was added to both of them, although the false positive rate
+// may be higher than that of a BloomFilter structure that only had those elements added.
+// ErrIncompatibleFilters is returned when the two BloomFilter structures differ in size, number of hash functions
+// or hash functions.
+func (bf *BloomFilter) Intersect(other *BloomFilter) error {
+	if !bf.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	for i := range bf.bits {
+		bf.bits[i] &= other.bits[i]
+	}
+	bf.bitsSet = bf.popcount()
+	if other.count < bf.count {
+		bf.count = other.count
+	}
+	return nil
+}
+
+// Merge implements Merger. other must be a BloomFilter or BloomFilterTS structure, whose elements are added
+// as by Union; ErrIncompatibleFilters is returned for any other filter.
+func (bf *BloomFilter) Merge(other Filter) error {
+	switch o := other.(type) {
+	case *BloomFilter:
+		return bf.Union(o)
+	case *BloomFilterTS:
+		o.mtx.RLock()
+		defer o.mtx.RUnlock()
+		return bf.Union(o.bf)
+	}
+	return ErrIncompatibleFilters
+}
+
+// clone returns a copy of the BloomFilter structure that shares its hash functions.
+// The copy has no false positive rate threshold set.
+func (bf *BloomFilter) clone() *BloomFilter {
+	c := *bf
+	c.bits = make([]uint64, len(bf.bits))
+	copy(c.bits, bf.bits)
+	c.fpRateThreshold, c.onThreshold, c.thresholdFired = 0, nil, false
+	return &c
+}
+
+// NewUnion returns a new BloomFilter structure that is the union of a and b, leaving both of them unchanged.
+// For more details, please see Union method.
+func NewUnion(a *BloomFilter, b *BloomFilter) (*BloomFilter, error) {
+	if !a.compatible(b) {
+		return nil, ErrIncompatibleFilters
+	}
+	bf := a.clone()
+	bf.Union(b)
+	return bf, nil
+}
+
+// NewIntersection returns a new BloomFilter structure that is the intersection of a and b, leaving both of them unchanged.
+// For more details, please see Intersect method.
+func NewIntersection(a *BloomFilter, b *BloomFilter) (*BloomFilter, error) {
+	if !a.compatible(b) {
+		return nil, ErrIncompatibleFilters
+	}
+	bf := a.clone()
+	bf.Intersect(b)
+	return bf, nil
+}
+
+// lockPair locks a for writing when write is true and for reading otherwise, and b for reading.
+// Locks are always taken in the order of the structures' addresses, so that two goroutines combining
+// the same structures in opposite order cannot deadlock. When a and b are the same structure, it is locked once.
+// The returned function releases the locks.
+func lockPair(a *BloomFilterTS, b *BloomFilterTS, write bool) func() {
+	lockA, unlockA := a.mtx.RLock, a.mtx.RUnlock
+	if write {
+		lockA, unlockA = a.mtx.Lock, a.mtx.Unlock
+	}
+	if a == b {
+		lockA()
+		return unlockA
+	}
+
+	if uintptr(unsafe.Pointer(a)) < uintptr(unsafe.Pointer(b)) {
+		lockA()
+		b.mtx.RLock()
+	} else {
+		b.mtx.RLock()
+		lockA()
+	}
+	return func() {
+		b.mtx.RUnlock()
+		unlockA()
+	}
+}
+
+// Union for thread safe BloomFilterTS structure serves the same purpose as Union for BloomFilter structure.
+// Both structures are locked for the duration of the call.
+func (bfts *BloomFilterTS) Union(other *BloomFilterTS) error {
+	unlock := lockPair(bfts, other, true)
+	defer unlock()
+	return bfts.bf.Union(other.bf)
+}
+
+// Intersect for thread safe BloomFilterTS structure serves the same purpose as Intersect for BloomFilter structure.
+// Both structures are locked for the duration of the call.
+func (bfts *BloomFilterTS) Intersect(other *BloomFilterTS) error {
+	unlock := lockPair(bfts, other, true)
+	defer unlock()
+	return bfts.bf.Intersect(other.bf)
+}
+
+// Merge for thread safe BloomFilterTS structure serves the same purpose as Merge for BloomFilter structure.
+// Both structures are locked for the duration of the call.
+func (bfts *BloomFilterTS) Merge(other Filter) error {
+	switch o := other.(type) {
+	case *BloomFilterTS:
+		return bfts.Union(o)
+	case *BloomFilter:
+		bfts.mtx.Lock()
+		defer bfts.mtx.Unlock()
+		return bfts.bf.Union(o)
+	}
+	return ErrIncompatibleFilters
+}
+
+// NewTSUnion returns a new BloomFilterTS structure. For more details, please see NewUnion function.
+func NewTSUnion(a *BloomFilterTS, b *BloomFilterTS) (*BloomFilterTS, error) {
+	unlock := lockPair(a, b, false)
+	defer unlock()
+	bf, err := NewUnion(a.bf, b.bf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BloomFilterTS{bf: bf}, nil
+}
+
+// NewTSIntersection returns a new BloomFilterTS structure. For more details, please see NewIntersection function.
+func NewTSIntersection(a *BloomFilterTS, b *BloomFilterTS) (*BloomFilterTS, error) {
+	unlock := lockPair(a, b, false)
+	defer unlock()
+	bf, err := NewIntersection(a.bf, b.bf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BloomFilterTS{bf: bf}, nil
+}
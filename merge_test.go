@@ -0,0 +1,216 @@
+package bloomfilter
+
+import (
+	"hash/crc64"
+	"sync"
+	"testing"
+)
+
+func TestBloomFilterUnionIntersect(t *testing.T) {
+	var (
+		count     = 10000
+		numItems  = uint64(2 * count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	testsA := prepTestCases(count, minStrLen, maxStrLen)
+	testsB := prepTestCases(count, minStrLen, maxStrLen)
+	common := prepTestCases(count/10, minStrLen, maxStrLen)
+
+	a, err := NewByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	b, err := NewByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range testsA {
+		a.Add(tt.data)
+	}
+	for _, tt := range testsB {
+		b.Add(tt.data)
+	}
+	for _, tt := range common {
+		a.Add(tt.data)
+		b.Add(tt.data)
+	}
+	bitsA := append([]uint64(nil), a.bits...)
+
+	union, err := NewUnion(a, b)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tests := range [][]testCase{testsA, testsB, common} {
+		for _, tt := range tests {
+			if result := union.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+		}
+	}
+
+	intersection, err := NewIntersection(a, b)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range common {
+		if result := intersection.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+	onlyA := 0
+	for _, tt := range testsA {
+		if !intersection.Query(tt.data) {
+			onlyA++
+		}
+	}
+	if onlyA < count/2 {
+		t.Errorf("expected most elements of only one bloom filter to test negative in the intersection, only %v out of %v did", onlyA, count)
+	}
+
+	for i := range bitsA {
+		if a.bits[i] != bitsA[i] {
+			t.Errorf("expected NewUnion and NewIntersection to leave their arguments unchanged")
+			break
+		}
+	}
+
+	if err := a.Union(b); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for i := range a.bits {
+		if a.bits[i] != union.bits[i] {
+			t.Errorf("expected Union to produce the same bits as NewUnion")
+			break
+		}
+	}
+	if err := a.Intersect(b); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for i := range a.bits {
+		if a.bits[i] != b.bits[i] {
+			t.Errorf("expected the intersection of a union with one of its parts to be that part")
+			break
+		}
+	}
+}
+
+func TestBloomFilterUnionIncompatible(t *testing.T) {
+	bf, err := NewBySizeAndNumHashFuncs(1000, 3, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	others := []struct {
+		description      string
+		size             uint64
+		numHashFunctions uint8
+		crc              bool
+	}{
+		{"size", 1001, 3, false},
+		{"number of hash functions", 1000, 4, false},
+		{"hash functions", 1000, 3, true},
+	}
+	for _, tt := range others {
+		t.Run(tt.description, func(t *testing.T) {
+			var other *BloomFilter
+			if tt.crc {
+				other, err = NewBySizeAndNumHashFuncs(tt.size, tt.numHashFunctions, crc64.New(crc64.MakeTable(crc64.ISO)), nil)
+			} else {
+				other, err = NewBySizeAndNumHashFuncs(tt.size, tt.numHashFunctions, nil, nil)
+			}
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			if err := bf.Union(other); err != ErrIncompatibleFilters {
+				t.Errorf("Union: expected error %v, actual %v", ErrIncompatibleFilters, err)
+			}
+			if err := bf.Intersect(other); err != ErrIncompatibleFilters {
+				t.Errorf("Intersect: expected error %v, actual %v", ErrIncompatibleFilters, err)
+			}
+			if u, err := NewUnion(bf, other); u != nil || err != ErrIncompatibleFilters {
+				t.Errorf("NewUnion: expected nil bloom filter and error %v, actual %v and %v", ErrIncompatibleFilters, u, err)
+			}
+			if i, err := NewIntersection(bf, other); i != nil || err != ErrIncompatibleFilters {
+				t.Errorf("NewIntersection: expected nil bloom filter and error %v, actual %v and %v", ErrIncompatibleFilters, i, err)
+			}
+		})
+	}
+}
+
+// This test should neither deadlock nor fail when "go test -race" command is issued.
+func TestBloomFilterTSUnionParallel(t *testing.T) {
+	var (
+		count      = 1000
+		numItems   = uint64(count)
+		fp         = 0.01
+		maxStrLen  = 50
+		minStrLen  = 20
+		goroutines = 4
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	a, err := NewTSByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	b, err := NewTSByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < count; i += goroutines {
+				a.Add(tests[i].data)
+				if err := a.Union(b); err != nil {
+					t.Errorf("Union: expected nil error, actual %v", err)
+				}
+				if err := b.Union(a); err != nil {
+					t.Errorf("Union: expected nil error, actual %v", err)
+				}
+				if err := a.Union(a); err != nil {
+					t.Errorf("Union: expected nil error, actual %v", err)
+				}
+				if _, err := NewTSIntersection(b, a); err != nil {
+					t.Errorf("NewTSIntersection: expected nil error, actual %v", err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if err := b.Union(a); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	union, err := NewTSUnion(a, b)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		if result := b.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+		if result := union.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+}
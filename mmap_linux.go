@@ -0,0 +1,339 @@
+//go:build linux
+
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// MapMode selects whether a MappedBloomFilter can be added to.
+type MapMode uint8
+
+const (
+	// MapReadOnly maps a bloom filter file for Query only. Add panics with ErrReadOnlyMapping.
+	MapReadOnly MapMode = iota
+
+	// MapReadWrite maps a bloom filter file for both Add and Query. Added elements are written to the file
+	// by the page cache at its own pace, and Sync writes the statistics and checksum and flushes the file.
+	// Several MappedBloomFilter structures, in one process or in many, may add to the same file at once,
+	// since bits are set with atomic OR operations, but the number of Add calls that Sync writes is that of
+	// the last one to call Sync, and the checksum only matches while no other one is adding.
+	MapReadWrite
+)
+
+// MappedBloomFilter is a non-thread safe bloom filter data structure whose bit array is a file written by WriteTo
+// or MarshalBinary, mapped into memory rather than read.
+//
+// Opening a multi-gigabyte bloom filter takes no more memory than its header, and the bits are backed by the page cache,
+// which is shared by every process that maps the same file. Only the header is read when the file is opened, so that
+// pages are read from disk as they are first accessed: the checksum is checked by Verify rather than on every open,
+// and the number of bits set is counted by the first Stats or EstimatedCount call.
+// Another process may truncate the file while it is mapped, and accessing pages past its new end raises SIGBUS.
+// Every access to the mapping recovers that fault, so NewMapped, TryAdd, TryQuery, Verify, Sync and Close return
+// ErrFileTruncated, and Add, Query, Stats and EstimatedCount, which can not return an error, panic with it
+// instead of crashing the process.
+// The bits are mapped as they are in the file, which is only possible on little endian CPUs.
+type MappedBloomFilter struct {
+	bf      *BloomFilter // bits point into data
+	data    []byte
+	file    *os.File
+	mode    MapMode
+	version uint8
+	counted bool // whether bf.bitsSet was counted from the bit array
+}
+
+// Add takes a byte slice as input and adds it to the MappedBloomFilter structure's bit array in the file.
+// It panics with the error that TryAdd returns, which is ErrReadOnlyMapping when the MappedBloomFilter structure
+// was opened with MapReadOnly and ErrFileTruncated when the file was truncated.
+func (mbf *MappedBloomFilter) Add(data []byte) {
+	if err := mbf.TryAdd(data); err != nil {
+		panic(err)
+	}
+}
+
+// TryAdd is Add returning an error instead of panicking: ErrReadOnlyMapping when the MappedBloomFilter structure
+// was opened with MapReadOnly, since the mapping can not be written to, and ErrFileTruncated when the file was truncated.
+func (mbf *MappedBloomFilter) TryAdd(data []byte) (err error) {
+	if mbf.mode != MapReadWrite {
+		return ErrReadOnlyMapping
+	}
+	defer mbf.recoverFault(&err)
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	bf := mbf.bf
+	hash1Val, hash2Val := bf.hasher.Sum128(data)
+	for i := uint8(0); i < bf.numHashFunctions; i++ {
+		currLoc := location(hash1Val, hash2Val, i, bf.size)
+		mask := uint64(1) << (currLoc % 64)
+		if atomic.OrUint64(&bf.bits[currLoc/64], mask)&mask == 0 {
+			bf.bitsSet++
+		}
+	}
+	bf.count++
+	return nil
+}
+
+// Query tests the byte slice input's existence in the MappedBloomFilter structure and returns a boolean value.
+// As with BloomFilter, false positives are possible, while false negatives are not.
+// It panics with ErrFileTruncated when the file was truncated, since it can not tell whether the byte slice exists.
+func (mbf *MappedBloomFilter) Query(data []byte) bool {
+	exists, err := mbf.TryQuery(data)
+	if err != nil {
+		panic(err)
+	}
+	return exists
+}
+
+// TryQuery is Query returning ErrFileTruncated instead of panicking when the file was truncated.
+func (mbf *MappedBloomFilter) TryQuery(data []byte) (exists bool, err error) {
+	defer mbf.recoverFault(&err)
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	return mbf.bf.Query(data), nil
+}
+
+// recoverFault recovers a fault on the mapping, which is raised instead of SIGBUS while SetPanicOnFault is set,
+// and reports it in err as ErrFileTruncated. Any other panic goes on.
+// It must be deferred before SetPanicOnFault is set, so that it runs after the previous setting is restored.
+func (mbf *MappedBloomFilter) recoverFault(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if f, ok := r.(interface{ Addr() uintptr }); ok && len(mbf.data) > 0 {
+		if start := uintptr(unsafe.Pointer(&mbf.data[0])); f.Addr() >= start && f.Addr()-start < uintptr(len(mbf.data)) {
+			*err = ErrFileTruncated
+			return
+		}
+	}
+	panic(r)
+}
+
+// countBits counts the bits set in the bit array once, panicking with ErrFileTruncated when the file was truncated.
+// Bits set by Add calls before it are counted with the rest, and Add keeps the count afterwards.
+func (mbf *MappedBloomFilter) countBits() {
+	if mbf.counted {
+		return
+	}
+	var err error
+	func() {
+		defer mbf.recoverFault(&err)
+		defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+		mbf.bf.bitsSet = mbf.bf.popcount()
+	}()
+	if err != nil {
+		panic(err)
+	}
+	mbf.counted = true
+}
+
+// Stats returns statistics about how saturated the MappedBloomFilter structure is.
+// The first call reads the whole bit array to count the bits set, and panics with ErrFileTruncated
+// when the file was truncated.
+func (mbf *MappedBloomFilter) Stats() Stats {
+	mbf.countBits()
+	return mbf.bf.Stats()
+}
+
+// EstimatedCount returns the approximate number of distinct elements that were added to the MappedBloomFilter structure.
+// As with Stats, the first call reads the whole bit array.
+func (mbf *MappedBloomFilter) EstimatedCount() uint64 {
+	mbf.countBits()
+	return mbf.bf.EstimatedCount()
+}
+
+// Verify reads the whole bit array and returns ErrChecksumMismatch when it does not match the checksum in the file,
+// which is the check that NewFromReader and UnmarshalBinary do and NewMapped leaves out.
+// With MapReadWrite, the checksum is only written by Sync. ErrFileTruncated is returned when the file was truncated.
+func (mbf *MappedBloomFilter) Verify() (err error) {
+	defer mbf.recoverFault(&err)
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	end := headerLenOf(mbf.data) + 8*len(mbf.bf.bits)
+	if binary.LittleEndian.Uint32(mbf.data[end:]) != crc32.Checksum(mbf.data[:end], castagnoli) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// Sync writes the number of Add calls and the checksum of the bit array to the header and trailer of the file,
+// and waits until the whole file is written to disk, so that it can be read by NewFromReader or opened again.
+// It reads the whole bit array to calculate the checksum. With MapReadOnly, it does nothing.
+// ErrFileTruncated is returned when the file was truncated.
+func (mbf *MappedBloomFilter) Sync() (err error) {
+	if mbf.mode != MapReadWrite {
+		return nil
+	}
+	defer mbf.recoverFault(&err)
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	l := headerLenOf(mbf.data)
+	end := l + 8*len(mbf.bf.bits)
+	if mbf.version != 1 {
+		// version 1 has no number of Add calls, and its header is left as it is
+		binary.LittleEndian.PutUint64(mbf.data[24:32], mbf.bf.count)
+	}
+	binary.LittleEndian.PutUint32(mbf.data[end:], crc32.Checksum(mbf.data[:end], castagnoli))
+
+	return msync(mbf.data)
+}
+
+// Close unmaps and closes the file. With MapReadWrite, Sync is called first, and the file is unmapped and closed
+// even when Sync fails. The MappedBloomFilter structure must not be used afterwards.
+func (mbf *MappedBloomFilter) Close() error {
+	err := mbf.Sync()
+	mbf.bf.bits = nil
+	if uerr := syscall.Munmap(mbf.data); err == nil {
+		err = uerr
+	}
+	mbf.data = nil
+	if cerr := mbf.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewMapped maps the bloom filter file at path, written by WriteTo or MarshalBinary, into memory
+// and returns a MappedBloomFilter structure whose bit array is the file.
+// hash.Hash64 hash1 and hash.Hash64 hash2 must be the hash functions that the bloom filter was built with,
+// and when they are nil, a default hash.Hash64 for each will be used.
+// The errors of UnmarshalBinary are returned for files that can not be read by it, including truncated files,
+// except for ErrChecksumMismatch, which is left to Verify, and ErrUnmappable is returned when the bit array
+// in the file can not be used as it is.
+func NewMapped(path string, mode MapMode, hash1 hash.Hash64, hash2 hash.Hash64) (*MappedBloomFilter, error) {
+	return NewMappedWithHasher(path, mode, hasherOf(hash1, hash2))
+}
+
+// NewMappedWithHasher returns a new MappedBloomFilter structure. For more details, please see NewMapped function.
+// h must be the Hasher that the bloom filter was built with, and when it is nil, the Hasher returned by NewFNVHasher
+// will be used.
+func NewMappedWithHasher(path string, mode MapMode, h Hasher) (*MappedBloomFilter, error) {
+	flag, prot := os.O_RDONLY, syscall.PROT_READ
+	if mode == MapReadWrite {
+		flag, prot = os.O_RDWR, syscall.PROT_READ|syscall.PROT_WRITE
+	}
+	if h == nil {
+		h = fnvHasher{}
+	}
+
+	file, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	size := fi.Size()
+	if size < headerLenV1+checksumLen || size != int64(int(size)) {
+		file.Close()
+		return nil, ErrInvalidEncoding
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), prot, syscall.MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	mbf, err := newMapped(data, h)
+	if err != nil {
+		syscall.Munmap(data)
+		file.Close()
+		return nil, err
+	}
+	mbf.file, mbf.mode = file, mode
+
+	return mbf, nil
+}
+
+// newMapped returns a MappedBloomFilter structure whose bit array is in data, after verifying the header of data
+// the way UnmarshalBinary does. Bytes after the checksum are ignored.
+func newMapped(data []byte, h Hasher) (*MappedBloomFilter, error) {
+	mbf := MappedBloomFilter{data: data}
+	if err := mbf.open(h); err != nil {
+		return nil, err
+	}
+	return &mbf, nil
+}
+
+// open reads the header of the mapping and points the bit array of mbf into it.
+// Only the first page is accessed, and a file that was truncated since it was mapped fails with ErrFileTruncated.
+func (mbf *MappedBloomFilter) open(h Hasher) (err error) {
+	defer mbf.recoverFault(&err)
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	data := mbf.data
+	hd, err := parseHeader(data)
+	if err != nil {
+		return err
+	}
+	l := headerLenOf(data)
+	if len(data) < l+checksumLen {
+		return ErrInvalidEncoding
+	}
+	words := numWords(hd.size)
+	if words > uint64(len(data)-l-checksumLen)/8 {
+		return ErrInvalidEncoding
+	}
+	scheme := hashScheme(h)
+	if scheme != hd.hashScheme {
+		return ErrHashSchemeMismatch
+	}
+	bits, err := mapWords(data[l : l+8*int(words)])
+	if err != nil {
+		return err
+	}
+
+	mbf.bf = &BloomFilter{
+		hasher:           h,
+		hashScheme:       scheme,
+		numHashFunctions: hd.numHashFunctions,
+		size:             hd.size,
+		bits:             bits,
+		count:            hd.count,
+		capacity:         hd.capacity,
+	}
+	mbf.version = hd.version
+
+	return nil
+}
+
+// mapWords returns b as a slice of uint64 words that shares its memory.
+// ErrUnmappable is returned when b is not aligned to 8 bytes or the CPU is big endian, since the words
+// in the file are little endian.
+func mapWords(b []byte) ([]uint64, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	one := uint16(1)
+	if *(*byte)(unsafe.Pointer(&one)) != 1 {
+		return nil, ErrUnmappable
+	}
+	if uintptr(unsafe.Pointer(&b[0]))%8 != 0 || len(b)%8 != 0 {
+		return nil, ErrUnmappable
+	}
+	return unsafe.Slice((*uint64)(unsafe.Pointer(&b[0])), len(b)/8), nil
+}
+
+// msync flushes the pages of b, which is mapped from a file, to disk and waits until they are written.
+func msync(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+var _ Counter = (*MappedBloomFilter)(nil)
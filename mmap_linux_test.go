@@ -0,0 +1,391 @@
+//go:build linux
+
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"hash/crc64"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// writeMappedTestFile writes data to a new file in a temporary directory and returns its path.
+func writeMappedTestFile(t *testing.T, data []byte) string {
+	path := filepath.Join(t.TempDir(), "filter.bf")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	return path
+}
+
+func TestMappedBloomFilterReadOnly(t *testing.T) {
+	var (
+		count     = 10000
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	bf, err := NewByEstimates(uint64(count), 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		bf.Add(tt.data)
+	}
+	data, _ := bf.MarshalBinary()
+	path := writeMappedTestFile(t, data)
+
+	mbf, err := NewMapped(path, MapReadOnly, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	defer mbf.Close()
+
+	for _, tt := range tests {
+		if result := mbf.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+	if actual, expected := mbf.Stats(), bf.Stats(); actual != expected {
+		t.Errorf("Stats: expected %+v, actual %+v", expected, actual)
+	}
+	if err := mbf.Sync(); err != nil {
+		t.Errorf("Sync: expected nil error, actual %v", err)
+	}
+
+	if err := mbf.TryAdd([]byte("data")); err != ErrReadOnlyMapping {
+		t.Errorf("TryAdd: expected error %v, actual %v", ErrReadOnlyMapping, err)
+	}
+	defer func() {
+		if r := recover(); r != ErrReadOnlyMapping {
+			t.Errorf("Add: expected a panic with %v for a MappedBloomFilter opened with MapReadOnly, actual %v", ErrReadOnlyMapping, r)
+		}
+	}()
+	mbf.Add([]byte("data"))
+}
+
+// A file that another process truncates while it is mapped must fail the calls that access it rather than crash.
+func TestMappedBloomFilterTruncated(t *testing.T) {
+	bf, err := NewByEstimates(1000000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bf.Add([]byte("data"))
+	data, _ := bf.MarshalBinary()
+	path := writeMappedTestFile(t, data)
+
+	rw, err := NewMapped(path, MapReadWrite, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	ro, err := NewMapped(path, MapReadOnly, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	// the bits set are counted once, before the file is truncated
+	ro.Stats()
+	if err := os.Truncate(path, 0); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	if exists, err := ro.TryQuery([]byte("data")); exists || err != ErrFileTruncated {
+		t.Errorf("TryQuery: expected %v and error %v, actual %v and %v", false, ErrFileTruncated, exists, err)
+	}
+	if err := rw.TryAdd([]byte("more data")); err != ErrFileTruncated {
+		t.Errorf("TryAdd: expected error %v, actual %v", ErrFileTruncated, err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != ErrFileTruncated {
+				t.Errorf("Query: expected a panic with %v, actual %v", ErrFileTruncated, r)
+			}
+		}()
+		rw.Query([]byte("data"))
+	}()
+	func() {
+		defer func() {
+			if r := recover(); r != ErrFileTruncated {
+				t.Errorf("Stats: expected a panic with %v, actual %v", ErrFileTruncated, r)
+			}
+		}()
+		rw.Stats()
+	}()
+	if stats := ro.Stats(); stats != bf.Stats() {
+		t.Errorf("Stats: expected %+v, actual %+v", bf.Stats(), stats)
+	}
+	if err := ro.Verify(); err != ErrFileTruncated {
+		t.Errorf("Verify: expected error %v, actual %v", ErrFileTruncated, err)
+	}
+
+	if err := rw.Sync(); err != ErrFileTruncated {
+		t.Errorf("Sync: expected error %v, actual %v", ErrFileTruncated, err)
+	}
+	if err := rw.Close(); err != ErrFileTruncated {
+		t.Errorf("Close: expected error %v, actual %v", ErrFileTruncated, err)
+	}
+	if err := ro.Close(); err != nil {
+		t.Errorf("Close: expected nil error, actual %v", err)
+	}
+}
+
+func TestMappedBloomFilterReadWrite(t *testing.T) {
+	bf, err := NewByEstimates(1000, 0.01, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bf.Add([]byte("first"))
+	data, _ := bf.MarshalBinary()
+	path := writeMappedTestFile(t, data)
+
+	rw, err := NewMapped(path, MapReadWrite, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	ro, err := NewMapped(path, MapReadOnly, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	defer ro.Close()
+
+	rw.Add([]byte("second"))
+	// both mappings share the page cache, so the other one sees the bits before Sync
+	if result := ro.Query([]byte("second")); !result {
+		t.Errorf("Query(%v) of another mapping: expected %v, actual %v", "second", true, false)
+	}
+	if err := rw.Close(); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	defer f.Close()
+	loaded, err := NewFromReader(f, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, data := range []string{"first", "second"} {
+		if result := loaded.Query([]byte(data)); !result {
+			t.Errorf("Query(%v) after Close: expected %v, actual %v", data, true, false)
+		}
+	}
+	if stats := loaded.Stats(); stats.Count != 2 {
+		t.Errorf("expected Sync to write a count of %v, actual %v", 2, stats.Count)
+	}
+}
+
+// Several mappings of the same file must not lose each other's bits when they add at once.
+func TestMappedBloomFilterWriters(t *testing.T) {
+	var (
+		count   = 100000
+		writers = 4
+	)
+
+	bf, err := NewByEstimates(uint64(count), 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	data, _ := bf.MarshalBinary()
+	path := writeMappedTestFile(t, data)
+
+	tests := prepTestCases(count, 20, 50)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		mbf, err := NewMapped(path, MapReadWrite, nil, nil)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		defer mbf.Close()
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < count; i += writers {
+				mbf.Add(tests[i].data)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	ro, err := NewMapped(path, MapReadOnly, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	defer ro.Close()
+	for _, tt := range tests {
+		if result := ro.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			break
+		}
+	}
+}
+
+// Files with a version 1 header, which is shorter, map the bits at their own offset and keep their header on Sync.
+func TestMappedBloomFilterVersion1(t *testing.T) {
+	bf, err := NewByEstimates(1000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bf.Add([]byte("data"))
+	data, _ := bf.MarshalBinary()
+
+	v1 := append([]byte(nil), data[:headerLenV1]...)
+	v1[4] = 1
+	for i := 24; i < headerLenV1; i++ {
+		v1[i] = 0
+	}
+	v1 = append(v1, data[headerLen:len(data)-checksumLen]...)
+	v1 = binary.LittleEndian.AppendUint32(v1, crc32.Checksum(v1, castagnoli))
+	path := writeMappedTestFile(t, v1)
+
+	mbf, err := NewMapped(path, MapReadWrite, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if result := mbf.Query([]byte("data")); !result {
+		t.Errorf("Query(%v): expected %v, actual %v", "data", true, false)
+	}
+	mbf.Add([]byte("more data"))
+	if err := mbf.Close(); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	synced, err := os.ReadFile(path)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if !bytes.Equal(synced[:headerLenV1], v1[:headerLenV1]) {
+		t.Errorf("expected Sync to keep the version 1 header")
+	}
+	var loaded BloomFilter
+	if err := loaded.UnmarshalBinary(synced); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if result := loaded.Query([]byte("more data")); !result {
+		t.Errorf("Query(%v) after Close: expected %v, actual %v", "more data", true, false)
+	}
+}
+
+func TestNewMappedErrors(t *testing.T) {
+	bf, err := NewByEstimates(1000, 0.01, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	data, _ := bf.MarshalBinary()
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[headerLen] ^= 1
+	versioned := append([]byte(nil), data...)
+	versioned[4] = 99
+	tests := []struct {
+		description string
+		data        []byte
+		err         error
+	}{
+		{"empty", nil, ErrInvalidEncoding},
+		{"header only", data[:headerLen], ErrInvalidEncoding},
+		{"truncated checksum", data[:len(data)-1], ErrInvalidEncoding},
+		{"truncated bits", data[:len(data)-9], ErrInvalidEncoding},
+		{"magic", append([]byte("BLMC"), data[4:]...), ErrInvalidEncoding},
+		{"version", versioned, ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		path := writeMappedTestFile(t, tt.data)
+		for _, mode := range []MapMode{MapReadOnly, MapReadWrite} {
+			if mbf, err := NewMapped(path, mode, nil, nil); mbf != nil || err != tt.err {
+				t.Errorf("%v: expected nil MappedBloomFilter and error %v, actual %v and %v", tt.description, tt.err, mbf, err)
+			}
+		}
+	}
+
+	// the checksum is only checked by Verify
+	path := writeMappedTestFile(t, corrupted)
+	mbf, err := NewMapped(path, MapReadOnly, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if err := mbf.Verify(); err != ErrChecksumMismatch {
+		t.Errorf("Verify: expected error %v, actual %v", ErrChecksumMismatch, err)
+	}
+	mbf.Close()
+
+	path = writeMappedTestFile(t, data)
+	if mbf, err := NewMapped(path, MapReadOnly, nil, nil); err != nil || mbf.Verify() != nil {
+		t.Errorf("Verify: expected nil error, actual %v", err)
+	} else {
+		mbf.Close()
+	}
+	if _, err := NewMapped(path, MapReadOnly, nil, crc64.New(crc64Table)); err != ErrHashSchemeMismatch {
+		t.Errorf("hash functions: expected error %v, actual %v", ErrHashSchemeMismatch, err)
+	}
+	if _, err := NewMapped(filepath.Join(t.TempDir(), "missing.bf"), MapReadOnly, nil, nil); !os.IsNotExist(err) {
+		t.Errorf("missing file: expected a not exist error, actual %v", err)
+	}
+}
+
+func TestMapWordsUnaligned(t *testing.T) {
+	backing := make([]uint64, 3)
+	b := unsafe.Slice((*byte)(unsafe.Pointer(&backing[0])), 24)
+	if words, err := mapWords(b[8:24]); err != nil || len(words) != 2 {
+		t.Errorf("mapWords of 16 aligned bytes: expected 2 words and nil error, actual %v and %v", len(words), err)
+	}
+	if _, err := mapWords(b[4:20]); err != ErrUnmappable {
+		t.Errorf("mapWords of unaligned bytes: expected error %v, actual %v", ErrUnmappable, err)
+	}
+	if _, err := mapWords(b[8:20]); err != ErrUnmappable {
+		t.Errorf("mapWords of a partial word: expected error %v, actual %v", ErrUnmappable, err)
+	}
+}
+
+func TestMappedBloomFilterConformance(t *testing.T) {
+	bf, err := NewByEstimatesWithHasher(conformanceNumItems, conformanceFPRate, NewXXHasher(0))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	data, _ := bf.MarshalBinary()
+	dir := t.TempDir()
+
+	n := 0
+	testFilter(t, func() (Filter, error) {
+		n++
+		path := filepath.Join(dir, string(rune('a'+n%26))+".bf")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, err
+		}
+		mbf, err := NewMappedWithHasher(path, MapReadWrite, NewXXHasher(0))
+		if err == nil {
+			t.Cleanup(func() { mbf.Close() })
+		}
+		return mbf, err
+	})
+}
@@ -0,0 +1,222 @@
+package bloomfilter
+
+import (
+	"math"
+)
+
+// ThreadSafety selects the bloom filter structure that New returns.
+type ThreadSafety uint8
+
+const (
+	// NotThreadSafe makes New return a BloomFilter structure, which is the default.
+	NotThreadSafe ThreadSafety = iota
+
+	// Locked makes New return a BloomFilterTS structure, which guards a BloomFilter structure with a RWMutex.
+	Locked
+
+	// LockFree makes New return an AtomicBloomFilter structure.
+	LockFree
+)
+
+// Option configures the bloom filter that New creates.
+type Option func(*options)
+
+// options holds the configuration of a bloom filter as given by Option values.
+type options struct {
+	numItems         uint64
+	fpRate           float64
+	size             uint64
+	numHashFunctions uint8
+	memoryBudget     uint64 // in bytes
+	hasher           Hasher
+	seed             uint64
+	threadSafety     ThreadSafety
+	set              uint8 // opt* flags of the options that were given
+}
+
+const (
+	optEstimates = 1 << iota
+	optSize
+	optMemoryBudget
+	optHasher
+	optSeed
+)
+
+// WithEstimates sizes the bloom filter for estimated number of items and estimated false positive rate,
+// as NewByEstimates does. It conflicts with WithSize.
+func WithEstimates(numItems uint64, fpRate float64) Option {
+	return func(o *options) {
+		o.numItems, o.fpRate = numItems, fpRate
+		o.set |= optEstimates
+	}
+}
+
+// WithSize sets the size in bits and the number of hash functions of the bloom filter,
+// as NewBySizeAndNumHashFuncs does. It conflicts with WithEstimates.
+func WithSize(size uint64, numHashFunctions uint8) Option {
+	return func(o *options) {
+		o.size, o.numHashFunctions, o.numItems = size, numHashFunctions, 0
+		o.set |= optSize
+	}
+}
+
+// WithMemoryBudget limits the bit array of the bloom filter to numBytes bytes, which must be at least 8.
+// With WithEstimates, a bit array that would take more is shrunk to numBytes bytes, and the number of hash functions
+// is the ideal one for that size, so the false positive rate will be higher than estimated.
+// With WithSize, a size that takes more than numBytes bytes is an error.
+func WithMemoryBudget(numBytes uint64) Option {
+	return func(o *options) {
+		o.memoryBudget = numBytes
+		o.set |= optMemoryBudget
+	}
+}
+
+// WithHasher sets the Hasher of the bloom filter. h can be nil and when it is nil, the Hasher returned by
+// NewFNVHasher will be used, which is also the default. It conflicts with WithSeed.
+func WithHasher(h Hasher) Option {
+	return func(o *options) {
+		o.hasher = h
+		o.set |= optHasher
+	}
+}
+
+// WithSeed makes the bloom filter hash with the Hasher returned by NewXXHasher(seed), so that bloom filters
+// with different seeds set different bits for the same elements. It conflicts with WithHasher.
+func WithSeed(seed uint64) Option {
+	return func(o *options) {
+		o.seed = seed
+		o.set |= optSeed
+	}
+}
+
+// WithThreadSafety selects the bloom filter structure that New returns. The default is NotThreadSafe.
+func WithThreadSafety(mode ThreadSafety) Option {
+	return func(o *options) {
+		o.threadSafety = mode
+	}
+}
+
+// New returns a new bloom filter configured by opts. Either WithEstimates or WithSize must be given.
+// The returned Filter is a *BloomFilter, *BloomFilterTS or *AtomicBloomFilter as selected by WithThreadSafety.
+// ErrConflictingOptions is returned when options that exclude each other are given, and the errors of
+// NewByEstimates and NewBySizeAndNumHashFuncs are returned for invalid values.
+func New(opts ...Option) (Filter, error) {
+	o := newOptions(opts...)
+	bf, err := o.build()
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.threadSafety {
+	case Locked:
+		return &BloomFilterTS{bf: bf}, nil
+	case LockFree:
+		abf := AtomicBloomFilter{
+			hasher:           bf.hasher,
+			numHashFunctions: bf.numHashFunctions,
+			size:             bf.size,
+			bits:             bf.bits,
+		}
+		return &abf, nil
+	}
+	return bf, nil
+}
+
+// newOptions returns the configuration given by opts. Later options override earlier ones of the same kind.
+func newOptions(opts ...Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// validate reports the first error of the configuration, checking conflicts before values.
+func (o *options) validate() error {
+	if o.set&optEstimates != 0 && o.set&optSize != 0 {
+		return ErrConflictingOptions
+	}
+	if o.set&optHasher != 0 && o.set&optSeed != 0 {
+		return ErrConflictingOptions
+	}
+	if o.threadSafety > LockFree {
+		return ErrInvalidThreadSafety
+	}
+	if o.set&optMemoryBudget != 0 && o.memoryBudget < 8 {
+		return ErrInvalidSize
+	}
+
+	if o.set&optSize != 0 {
+		if o.size == 0 {
+			return ErrInvalidSize
+		}
+		if o.size > MaxSize {
+			return ErrSizeOverflow
+		}
+		if o.numHashFunctions == 0 {
+			return ErrInvalidNumberOfHashFunctions
+		}
+		if o.set&optMemoryBudget != 0 && numWords(o.size) > o.memoryBudget/8 {
+			return ErrConflictingOptions
+		}
+		return nil
+	}
+
+	if o.numItems == 0 {
+		return ErrInvalidNumberOfItems
+	}
+	if !(o.fpRate > 0 && o.fpRate < 1) {
+		return ErrInvalidFalsePositiveRate
+	}
+	return nil
+}
+
+// build validates the configuration and returns a new BloomFilter structure for it.
+// Every constructor of BloomFilter, BloomFilterTS and AtomicBloomFilter goes through it.
+func (o *options) build() (*BloomFilter, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	h := o.hasher
+	if o.set&optSeed != 0 {
+		h = NewXXHasher(o.seed)
+	}
+	if h == nil {
+		h = fnvHasher{}
+	}
+
+	if o.set&optSize != 0 {
+		bf := newBloomFilter(o.size, o.numHashFunctions, h)
+		if o.numItems > 0 {
+			bf.capacity = o.numItems
+		}
+		return bf, nil
+	}
+
+	size, numHashFunctions, err := estimates(o.numItems, o.fpRate)
+	if err != nil {
+		return nil, err
+	}
+	if o.set&optMemoryBudget != 0 && numWords(size) > o.memoryBudget/8 {
+		size = 64 * (o.memoryBudget / 8)
+		numHashFunctions = idealNumHashFunctions(size, o.numItems)
+	}
+	bf := newBloomFilter(size, numHashFunctions, h)
+	bf.capacity = o.numItems
+
+	return bf, nil
+}
+
+// idealNumHashFunctions returns the number of hash functions that minimizes the false positive rate
+// of a bloom filter of size bits that holds numItems items, clamped to [1, MaxHashFunctions].
+func idealNumHashFunctions(size uint64, numItems uint64) uint8 {
+	k := math.Ceil(math.Log(2) * float64(size) / float64(numItems))
+	if k > MaxHashFunctions {
+		return MaxHashFunctions
+	}
+	if k < 1 {
+		return 1
+	}
+	return uint8(k)
+}
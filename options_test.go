@@ -0,0 +1,167 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestNewOptionsErrors(t *testing.T) {
+	tests := []struct {
+		description string
+		opts        []Option
+		err         error
+	}{
+		{"no options", nil, ErrInvalidNumberOfItems},
+		{"zero items", []Option{WithEstimates(0, 0.01)}, ErrInvalidNumberOfItems},
+		{"zero false positive rate", []Option{WithEstimates(100, 0)}, ErrInvalidFalsePositiveRate},
+		{"false positive rate of 1", []Option{WithEstimates(100, 1)}, ErrInvalidFalsePositiveRate},
+		{"false positive rate of NaN", []Option{WithEstimates(100, math.NaN())}, ErrInvalidFalsePositiveRate},
+		{"zero size", []Option{WithSize(0, 3)}, ErrInvalidSize},
+		{"zero hash functions", []Option{WithSize(1000, 0)}, ErrInvalidNumberOfHashFunctions},
+		{"zero memory budget", []Option{WithEstimates(100, 0.01), WithMemoryBudget(0)}, ErrInvalidSize},
+		{"memory budget below a word", []Option{WithEstimates(100, 0.01), WithMemoryBudget(7)}, ErrInvalidSize},
+		{"estimates and size", []Option{WithEstimates(100, 0.01), WithSize(1000, 3)}, ErrConflictingOptions},
+		{"size and estimates", []Option{WithSize(1000, 3), WithEstimates(100, 0.01)}, ErrConflictingOptions},
+		{"hasher and seed", []Option{WithEstimates(100, 0.01), WithHasher(NewXXHasher(1)), WithSeed(1)}, ErrConflictingOptions},
+		{"size above memory budget", []Option{WithSize(1000, 3), WithMemoryBudget(64)}, ErrConflictingOptions},
+		{"conflict before invalid value", []Option{WithEstimates(0, 0.01), WithSize(0, 0)}, ErrConflictingOptions},
+		{"unknown thread safety", []Option{WithEstimates(100, 0.01), WithThreadSafety(LockFree + 1)}, ErrInvalidThreadSafety},
+	}
+
+	for _, tt := range tests {
+		if f, err := New(tt.opts...); f != nil || err != tt.err {
+			t.Errorf("%v: expected nil filter and error %v, actual %v and %v", tt.description, tt.err, f, err)
+		}
+	}
+}
+
+func TestNewThreadSafety(t *testing.T) {
+	tests := []struct {
+		mode     ThreadSafety
+		expected string
+	}{
+		{NotThreadSafe, "*bloomfilter.BloomFilter"},
+		{Locked, "*bloomfilter.BloomFilterTS"},
+		{LockFree, "*bloomfilter.AtomicBloomFilter"},
+	}
+
+	for _, tt := range tests {
+		f, err := New(WithEstimates(1000, 0.01), WithThreadSafety(tt.mode))
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if actual := fmt.Sprintf("%T", f); actual != tt.expected {
+			t.Errorf("WithThreadSafety(%v): expected %v, actual %v", tt.mode, tt.expected, actual)
+		}
+	}
+}
+
+// New must size bloom filters exactly as the constructors that it replaces.
+func TestNewSizing(t *testing.T) {
+	f, err := New(WithEstimates(10000, 0.001))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	bf, err := NewByEstimates(10000, 0.001, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if actual, expected := f.(*BloomFilter).Stats(), bf.Stats(); actual != expected {
+		t.Errorf("WithEstimates: expected %+v, actual %+v", expected, actual)
+	}
+
+	f, err = New(WithSize(1000, 3), WithMemoryBudget(128))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if stats := f.(*BloomFilter).Stats(); stats.Size != 1000 || stats.NumHashFunctions != 3 {
+		t.Errorf("WithSize: expected size 1000 and 3 hash functions, actual %v and %v", stats.Size, stats.NumHashFunctions)
+	}
+
+	// 10000 items at 0.001 take about 18KB, which the budget shrinks to 4KB
+	f, err = New(WithEstimates(10000, 0.001), WithMemoryBudget(4100))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	stats := f.(*BloomFilter).Stats()
+	if stats.Size != 4096*8 {
+		t.Errorf("WithMemoryBudget: expected size %v, actual %v", 4096*8, stats.Size)
+	}
+	if expected := idealNumHashFunctions(stats.Size, 10000); stats.NumHashFunctions != expected {
+		t.Errorf("WithMemoryBudget: expected %v hash functions, actual %v", expected, stats.NumHashFunctions)
+	}
+	if stats.Capacity != 10000 {
+		t.Errorf("WithMemoryBudget: expected capacity %v, actual %v", 10000, stats.Capacity)
+	}
+
+	// a budget larger than the estimates needs leaves the bloom filter as it is
+	f, err = New(WithEstimates(10000, 0.001), WithMemoryBudget(1<<20))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if actual, expected := f.(*BloomFilter).Stats(), bf.Stats(); actual != expected {
+		t.Errorf("WithMemoryBudget: expected %+v, actual %+v", expected, actual)
+	}
+}
+
+func TestNewWithSeed(t *testing.T) {
+	var (
+		count     = 1000
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	filters := make([]*BloomFilter, 3)
+	for i, seed := range []uint64{1, 1, 2} {
+		f, err := New(WithEstimates(uint64(count), 0.01), WithSeed(seed))
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		filters[i] = f.(*BloomFilter)
+		for _, tt := range tests {
+			filters[i].Add(tt.data)
+		}
+	}
+
+	if !equalWords(filters[0].bits, filters[1].bits) {
+		t.Errorf("expected bloom filters with the same seed to set the same bits")
+	}
+	if equalWords(filters[0].bits, filters[2].bits) {
+		t.Errorf("expected bloom filters with different seeds to set different bits")
+	}
+	if _, err := New(WithEstimates(uint64(count), 0.01), WithSeed(1), WithThreadSafety(Locked)); err != nil {
+		t.Errorf("WithSeed and WithThreadSafety: expected nil error, actual %v", err)
+	}
+}
+
+func equalWords(a []uint64, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewConformance(t *testing.T) {
+	for _, mode := range []ThreadSafety{NotThreadSafe, Locked, LockFree} {
+		mode := mode
+		t.Run(fmt.Sprint(mode), func(t *testing.T) {
+			testFilter(t, func() (Filter, error) {
+				return New(WithEstimates(conformanceNumItems, conformanceFPRate), WithSeed(0), WithThreadSafety(mode))
+			})
+		})
+	}
+}
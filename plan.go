@@ -0,0 +1,231 @@
+package bloomfilter
+
+import (
+	"math"
+)
+
+// Plan is the size and number of hash functions of a bloom filter, together with the number of items it is planned
+// for and the false positive rate it is expected to have once that many items are added.
+// The PlanX functions solve for one of them given the others, with the formulas of NewByEstimates,
+// and a Plan is created by passing it to NewFromPlan, or to New with WithPlan.
+type Plan struct {
+	// NumItems is the number of items n.
+	NumItems uint64
+
+	// FPRate is the false positive rate p, which is (1 - e^(-k*n/m))^k.
+	FPRate float64
+
+	// Size is the size of the bit array in bits m.
+	Size uint64
+
+	// NumHashFunctions is the number of hash functions k.
+	NumHashFunctions uint8
+}
+
+// NumBytes returns the memory that the bit array of the planned bloom filter takes in bytes.
+func (p Plan) NumBytes() uint64 {
+	return 8 * numWords(p.Size)
+}
+
+// PlanSize plans a bloom filter that holds numItems items with a false positive rate of fpRate.
+// When numHashFunctions is 0, the plan is the size and number of hash functions that NewByEstimates chooses.
+// NewByEstimates rounds the number of hash functions up without growing the size, so the planned false positive rate
+// can be slightly higher than fpRate, by up to about 4 percent of it for false positive rates up to 0.1 and
+// 12.5 percent at 0.5. Otherwise, the plan is the smallest bloom filter with numHashFunctions hash functions
+// whose false positive rate is at most fpRate.
+// ErrSizeOverflow is returned when it would take more than MaxSize bits.
+func PlanSize(numItems uint64, numHashFunctions uint8, fpRate float64) (Plan, error) {
+	if numItems == 0 {
+		return Plan{}, ErrInvalidNumberOfItems
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return Plan{}, ErrInvalidFalsePositiveRate
+	}
+
+	if numHashFunctions == 0 {
+		size, k, err := estimates(numItems, fpRate)
+		if err != nil {
+			return Plan{}, err
+		}
+		return newPlan(numItems, size, k), nil
+	}
+	size, err := smallestSize(numItems, numHashFunctions, fpRate)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	return newPlan(numItems, size, numHashFunctions), nil
+}
+
+// PlanNumItems plans a bloom filter of size bits for the largest number of items that it holds with a false positive rate
+// of fpRate. When numHashFunctions is 0, that is the largest number of items for which NewByEstimates chooses at most
+// size bits, with the number of hash functions that it chooses, so that PlanSize of the planned number of items fits
+// in size bits. Otherwise, it is the largest number of items that size bits and numHashFunctions hash functions hold
+// with a false positive rate of at most fpRate.
+// ErrInfeasiblePlan is returned when size bits can not hold a single item at fpRate.
+func PlanNumItems(size uint64, numHashFunctions uint8, fpRate float64) (Plan, error) {
+	if size == 0 {
+		return Plan{}, ErrInvalidSize
+	}
+	if size > MaxSize {
+		return Plan{}, ErrSizeOverflow
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return Plan{}, ErrInvalidFalsePositiveRate
+	}
+
+	if numHashFunctions == 0 {
+		numItems := estimatedNumItemsFor(size, fpRate)
+		if numItems == 0 {
+			return Plan{}, ErrInfeasiblePlan
+		}
+		_, k, err := estimates(numItems, fpRate)
+		if err != nil {
+			return Plan{}, err
+		}
+		return newPlan(numItems, size, k), nil
+	}
+	numItems := numItemsFor(size, numHashFunctions, fpRate)
+	if numItems == 0 {
+		return Plan{}, ErrInfeasiblePlan
+	}
+
+	return newPlan(numItems, size, numHashFunctions), nil
+}
+
+// PlanFPRate plans a bloom filter of size bits for numItems items and returns the false positive rate that it will have.
+// When numHashFunctions is 0, the number of hash functions that NewByEstimates would choose for size bits is recommended.
+func PlanFPRate(numItems uint64, size uint64, numHashFunctions uint8) (Plan, error) {
+	if numItems == 0 {
+		return Plan{}, ErrInvalidNumberOfItems
+	}
+	if size == 0 {
+		return Plan{}, ErrInvalidSize
+	}
+	if size > MaxSize {
+		return Plan{}, ErrSizeOverflow
+	}
+	if numHashFunctions == 0 {
+		numHashFunctions = idealNumHashFunctions(size, numItems)
+	}
+
+	return newPlan(numItems, size, numHashFunctions), nil
+}
+
+// PlanNumHashFunctions plans a bloom filter of size bits for numItems items with the fewest hash functions that keep
+// the false positive rate at most fpRate, since every hash function makes Add and Query slower.
+// ErrInfeasiblePlan is returned when no number of hash functions does.
+func PlanNumHashFunctions(numItems uint64, size uint64, fpRate float64) (Plan, error) {
+	if numItems == 0 {
+		return Plan{}, ErrInvalidNumberOfItems
+	}
+	if size == 0 {
+		return Plan{}, ErrInvalidSize
+	}
+	if size > MaxSize {
+		return Plan{}, ErrSizeOverflow
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return Plan{}, ErrInvalidFalsePositiveRate
+	}
+
+	for k := 1; k <= MaxHashFunctions; k++ {
+		if p := newPlan(numItems, size, uint8(k)); p.FPRate <= fpRate {
+			return p, nil
+		}
+	}
+	return Plan{}, ErrInfeasiblePlan
+}
+
+// newPlan returns the Plan of a bloom filter of size bits and numHashFunctions hash functions that holds numItems items.
+func newPlan(numItems uint64, size uint64, numHashFunctions uint8) Plan {
+	return Plan{
+		NumItems:         numItems,
+		FPRate:           fpRateFor(numItems, size, numHashFunctions),
+		Size:             size,
+		NumHashFunctions: numHashFunctions,
+	}
+}
+
+// fpRateFor returns the false positive rate (1 - e^(-k*n/m))^k of a bloom filter of size bits m and numHashFunctions
+// hash functions k that holds numItems items n.
+func fpRateFor(numItems uint64, size uint64, numHashFunctions uint8) float64 {
+	k := float64(numHashFunctions)
+	return math.Exp(k * math.Log(-math.Expm1(-k*float64(numItems)/float64(size))))
+}
+
+// sizeFor returns the size in bits m, rounded up, of a bloom filter of numHashFunctions hash functions k
+// that holds numItems items n with a false positive rate p, which is fpRateFor solved for m: -k*n / ln(1 - p^(1/k)).
+// The result is a float64, so that callers can check it against MaxSize before converting it.
+func sizeFor(numItems uint64, numHashFunctions uint8, fpRate float64) float64 {
+	k := float64(numHashFunctions)
+	return math.Ceil(-k * float64(numItems) / math.Log(-math.Expm1(math.Log(fpRate)/k)))
+}
+
+// smallestSize returns the smallest size in bits of a bloom filter of numHashFunctions hash functions that holds
+// numItems items with a false positive rate of at most fpRate. sizeFor may be a bit too small because of floating
+// point rounding, so the size grows until fpRateFor agrees, by more than a bit once float64 can not tell sizes apart.
+func smallestSize(numItems uint64, numHashFunctions uint8, fpRate float64) (uint64, error) {
+	s := sizeFor(numItems, numHashFunctions, fpRate)
+	if !(s <= MaxSize) {
+		return 0, ErrSizeOverflow
+	}
+	size := uint64(s)
+	for fpRateFor(numItems, size, numHashFunctions) > fpRate {
+		size += 1 + size>>52
+		if size > MaxSize {
+			return 0, ErrSizeOverflow
+		}
+	}
+	return size, nil
+}
+
+// numItemsFor returns the largest number of items that a bloom filter of size bits and numHashFunctions hash functions
+// holds with a false positive rate of at most fpRate, which is fpRateFor solved for n: -m * ln(1 - p^(1/k)) / k.
+// As in smallestSize, the result is corrected for floating point rounding.
+func numItemsFor(size uint64, numHashFunctions uint8, fpRate float64) uint64 {
+	k := float64(numHashFunctions)
+	n := math.Floor(-1 * float64(size) * math.Log(-math.Expm1(math.Log(fpRate)/k)) / k)
+	if !(n >= 1) {
+		return 0
+	}
+	numItems := uint64(math.Min(n, math.MaxUint64/2))
+	for numItems > 0 && fpRateFor(numItems, size, numHashFunctions) > fpRate {
+		numItems -= 1 + numItems>>52
+	}
+	return numItems
+}
+
+// estimatedNumItemsFor returns the largest number of items for which estimates returns at most size bits,
+// which is the size calculated by estimates solved for n: m * ln(2)^2 / -ln(p), corrected for floating point rounding.
+func estimatedNumItemsFor(size uint64, fpRate float64) uint64 {
+	n := math.Floor(float64(size) * math.Pow(math.Log(2), 2) / (-1 * math.Log(fpRate)))
+	if !(n >= 1) {
+		return 0
+	}
+	numItems := uint64(math.Min(n, math.MaxUint64/2))
+	for numItems > 0 {
+		if s, _, err := estimates(numItems, fpRate); err != ErrSizeOverflow && s <= size {
+			break
+		}
+		numItems -= 1 + numItems>>52
+	}
+	return numItems
+}
+
+// WithPlan sets the size in bits and the number of hash functions of the bloom filter to the ones of p,
+// and its capacity to p.NumItems. It conflicts with WithEstimates, and replaces an earlier WithSize.
+func WithPlan(p Plan) Option {
+	return func(o *options) {
+		o.size, o.numHashFunctions, o.numItems = p.Size, p.NumHashFunctions, p.NumItems
+		o.set |= optSize
+	}
+}
+
+// NewFromPlan returns a new BloomFilter structure for the size and number of hash functions of p, whose locations
+// are created by double hashing of the two hash values of h. h can be nil and when it is nil, the Hasher returned by
+// NewFNVHasher will be used.
+func NewFromPlan(p Plan, h Hasher) (*BloomFilter, error) {
+	o := newOptions(WithPlan(p), WithHasher(h))
+	return o.build()
+}
@@ -0,0 +1,225 @@
+package bloomfilter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPlanErrors(t *testing.T) {
+	tests := []struct {
+		description string
+		plan        func() (Plan, error)
+		err         error
+	}{
+		{"PlanSize zero items", func() (Plan, error) { return PlanSize(0, 0, 0.01) }, ErrInvalidNumberOfItems},
+		{"PlanSize zero false positive rate", func() (Plan, error) { return PlanSize(1000, 0, 0) }, ErrInvalidFalsePositiveRate},
+		{"PlanSize false positive rate of NaN", func() (Plan, error) { return PlanSize(1000, 0, math.NaN()) }, ErrInvalidFalsePositiveRate},
+		{"PlanSize too many hash functions", func() (Plan, error) { return PlanSize(1000, 0, 1e-80) }, ErrTooManyHashFunctions},
+		{"PlanSize overflow", func() (Plan, error) { return PlanSize(math.MaxUint64, 7, 0.01) }, ErrSizeOverflow},
+		{"PlanNumItems zero size", func() (Plan, error) { return PlanNumItems(0, 0, 0.01) }, ErrInvalidSize},
+		{"PlanNumItems overflow", func() (Plan, error) { return PlanNumItems(MaxSize+1, 0, 0.01) }, ErrSizeOverflow},
+		{"PlanNumItems false positive rate of 1", func() (Plan, error) { return PlanNumItems(1000, 0, 1) }, ErrInvalidFalsePositiveRate},
+		{"PlanNumItems false positive rate of NaN", func() (Plan, error) { return PlanNumItems(1000, 0, math.NaN()) }, ErrInvalidFalsePositiveRate},
+		{"PlanNumItems infeasible", func() (Plan, error) { return PlanNumItems(1, 0, 1e-10) }, ErrInfeasiblePlan},
+		{"PlanNumItems infeasible with hash functions", func() (Plan, error) { return PlanNumItems(1, 3, 1e-10) }, ErrInfeasiblePlan},
+		{"PlanFPRate zero items", func() (Plan, error) { return PlanFPRate(0, 1000, 0) }, ErrInvalidNumberOfItems},
+		{"PlanFPRate zero size", func() (Plan, error) { return PlanFPRate(1000, 0, 0) }, ErrInvalidSize},
+		{"PlanNumHashFunctions zero false positive rate", func() (Plan, error) { return PlanNumHashFunctions(1000, 1000, 0) }, ErrInvalidFalsePositiveRate},
+		{"PlanNumHashFunctions false positive rate of NaN", func() (Plan, error) { return PlanNumHashFunctions(1000, 1000, math.NaN()) }, ErrInvalidFalsePositiveRate},
+		{"PlanNumHashFunctions infeasible", func() (Plan, error) { return PlanNumHashFunctions(1000, 1000, 0.001) }, ErrInfeasiblePlan},
+	}
+
+	for _, tt := range tests {
+		if p, err := tt.plan(); p != (Plan{}) || err != tt.err {
+			t.Errorf("%v: expected empty plan and error %v, actual %+v and %v", tt.description, tt.err, p, err)
+		}
+	}
+}
+
+// PlanSize must plan the number of hash functions that NewByEstimates chooses, and the smallest size that keeps
+// the false positive rate at most fpRate, which is NewByEstimates' size or up to about 1.5 percent more.
+func TestPlanSize(t *testing.T) {
+	for _, numItems := range []uint64{1, 1000, 1000000} {
+		for _, fpRate := range []float64{0.1, 0.01, 0.001, 1e-9} {
+			p, err := PlanSize(numItems, 0, fpRate)
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			bf, err := NewByEstimates(numItems, fpRate, nil, nil)
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			if stats := bf.Stats(); p.Size != stats.Size || p.NumHashFunctions != stats.NumHashFunctions || p.NumItems != stats.Capacity {
+				t.Errorf("PlanSize(%v, 0, %v): expected %v bits and %v hash functions, actual %+v", numItems, fpRate, stats.Size, stats.NumHashFunctions, p)
+			}
+			if p.FPRate > 1.05*fpRate {
+				t.Errorf("PlanSize(%v, 0, %v): expected a false positive rate close to %v, actual %+v", numItems, fpRate, fpRate, p)
+			}
+		}
+	}
+
+	// n = 1000 and p = 0.01 take 9586 bits, which are slightly too few once k is rounded up to 7
+	p, err := PlanSize(1000, 0, 0.01)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if p.NumHashFunctions != 7 || p.Size != 9586 || p.FPRate <= 0.01 {
+		t.Errorf("PlanSize(1000, 0, 0.01): expected 7 hash functions, 9586 bits and a false positive rate above 0.01, actual %+v", p)
+	}
+
+	p, err = PlanSize(1000, 3, 0.01)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if p.NumHashFunctions != 3 || p.FPRate > 0.01 || fpRateFor(1000, p.Size-1, 3) <= 0.01 {
+		t.Errorf("PlanSize(1000, 3, 0.01): expected the smallest size with 3 hash functions, actual %+v", p)
+	}
+	if p.NumBytes() != 8*numWords(p.Size) {
+		t.Errorf("NumBytes: expected %v, actual %v", 8*numWords(p.Size), p.NumBytes())
+	}
+}
+
+// A Plan for a given number of hash functions must never have a false positive rate above the fpRate it was planned for,
+// and a Plan without one must be the bloom filter that NewByEstimates creates.
+func TestPlanFPRateBound(t *testing.T) {
+	for _, numItems := range []uint64{1, 7, 100, 1000, 12345, 1000000, 1 << 40} {
+		for _, fpRate := range []float64{0.5, 0.3, 0.1, 0.05, 0.01, 0.001, 1e-4, 1e-6, 1e-9, 1e-15} {
+			for _, k := range []uint8{0, 1, 3, 7, 20} {
+				p, err := PlanSize(numItems, k, fpRate)
+				if err == ErrSizeOverflow {
+					continue
+				}
+				if err != nil {
+					t.Log(err.Error())
+					t.FailNow()
+				}
+				if k == 0 {
+					if size, k, _ := estimates(numItems, fpRate); p.Size != size || p.NumHashFunctions != k {
+						t.Errorf("PlanSize(%v, 0, %v): expected %v bits and %v hash functions, actual %+v", numItems, fpRate, size, k, p)
+					}
+					if q, err := PlanNumItems(p.Size, 0, fpRate); err != nil || q.NumItems < numItems {
+						t.Errorf("PlanNumItems(%v, 0, %v): expected at least %v items, actual %+v and %v", p.Size, fpRate, numItems, q, err)
+					}
+					continue
+				}
+				if p.FPRate > fpRate {
+					t.Errorf("PlanSize(%v, %v, %v): expected false positive rate of at most %v, actual %+v", numItems, k, fpRate, fpRate, p)
+				}
+
+				if p, err = PlanNumItems(p.Size, k, fpRate); err != nil {
+					t.Log(err.Error())
+					t.FailNow()
+				}
+				if p.FPRate > fpRate {
+					t.Errorf("PlanNumItems(%v, %v, %v): expected false positive rate of at most %v, actual %+v", p.Size, k, fpRate, fpRate, p)
+				}
+			}
+		}
+	}
+}
+
+// Given 256 MiB, the false positive rate for 500M items.
+func TestPlanFPRate(t *testing.T) {
+	size := uint64(256 << 20 * 8)
+	p, err := PlanFPRate(500000000, size, 0)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if p.NumHashFunctions != 3 || math.Abs(p.FPRate-0.1274) > 0.001 || p.NumBytes() != 256<<20 {
+		t.Errorf("PlanFPRate(500000000, %v, 0): expected 3 hash functions, false positive rate 0.1274 and %v bytes, actual %+v and %v bytes",
+			size, 256<<20, p, p.NumBytes())
+	}
+	for _, k := range []uint8{2, 4} {
+		other, err := PlanFPRate(500000000, size, k)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if other.NumHashFunctions != k || other.FPRate <= p.FPRate {
+			t.Errorf("PlanFPRate(500000000, %v, %v): expected %v hash functions and false positive rate above %v, actual %+v", size, k, k, p.FPRate, other)
+		}
+	}
+}
+
+func TestPlanNumItems(t *testing.T) {
+	size := uint64(256 << 20 * 8)
+	for _, fpRate := range []float64{0.1, 0.01, 0.001} {
+		p, err := PlanNumItems(size, 0, fpRate)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if planned, _ := PlanSize(p.NumItems, 0, fpRate); p.Size != size || planned.Size > size || planned.NumHashFunctions != p.NumHashFunctions {
+			t.Errorf("PlanNumItems(%v, 0, %v): expected PlanSize of %v items to fit, actual %+v", size, fpRate, p.NumItems, planned)
+		}
+		if planned, _ := PlanSize(p.NumItems+1, 0, fpRate); planned.Size <= size {
+			t.Errorf("PlanNumItems(%v, 0, %v): expected PlanSize of %v items not to fit, actual %+v", size, fpRate, p.NumItems+1, planned)
+		}
+		if _, k, _ := estimates(p.NumItems, fpRate); p.FPRate > 1.05*fpRate || k != p.NumHashFunctions {
+			t.Errorf("PlanNumItems(%v, 0, %v): expected the hash functions of NewByEstimates and a false positive rate close to %v, actual %+v",
+				size, fpRate, fpRate, p)
+		}
+
+		p, err = PlanNumItems(size, 4, fpRate)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if p.NumHashFunctions != 4 || p.FPRate > fpRate || fpRateFor(p.NumItems+1, size, 4) <= fpRate {
+			t.Errorf("PlanNumItems(%v, 4, %v): expected the largest number of items, actual %+v", size, fpRate, p)
+		}
+	}
+}
+
+func TestPlanNumHashFunctions(t *testing.T) {
+	p, err := PlanNumHashFunctions(1000, 9586, 0.02)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	k := p.NumHashFunctions
+	if p.FPRate > 0.02 || fpRateFor(1000, 9586, k-1) <= 0.02 {
+		t.Errorf("PlanNumHashFunctions(1000, 9586, 0.02): expected the fewest hash functions, actual %+v", p)
+	}
+	if ideal, _ := PlanFPRate(1000, 9586, 0); k >= ideal.NumHashFunctions {
+		t.Errorf("PlanNumHashFunctions(1000, 9586, 0.02): expected fewer than %v hash functions, actual %v", ideal.NumHashFunctions, k)
+	}
+}
+
+func TestNewFromPlan(t *testing.T) {
+	p, err := PlanSize(1000, 0, 0.01)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	bf, err := NewFromPlan(p, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if stats := bf.Stats(); stats.Size != p.Size || stats.NumHashFunctions != p.NumHashFunctions || stats.Capacity != p.NumItems {
+		t.Errorf("NewFromPlan(%+v): expected matching size, number of hash functions and capacity, actual %+v", p, stats)
+	}
+
+	f, err := New(WithPlan(p), WithThreadSafety(Locked))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if stats := f.(*BloomFilterTS).Stats(); stats.Size != p.Size || stats.NumHashFunctions != p.NumHashFunctions || stats.Capacity != p.NumItems {
+		t.Errorf("New(WithPlan(%+v)): expected matching size, number of hash functions and capacity, actual %+v", p, stats)
+	}
+
+	if _, err := New(WithEstimates(1000, 0.01), WithPlan(p)); err != ErrConflictingOptions {
+		t.Errorf("WithEstimates and WithPlan: expected error %v, actual %v", ErrConflictingOptions, err)
+	}
+	if _, err := NewFromPlan(Plan{}, nil); err != ErrInvalidSize {
+		t.Errorf("NewFromPlan of an empty plan: expected error %v, actual %v", ErrInvalidSize, err)
+	}
+}
@@ -0,0 +1,334 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"sync"
+)
+
+const (
+	// DefaultGrowthFactor is the growth factor of a ScalableBloomFilter when none is provided.
+	DefaultGrowthFactor uint64 = 2
+
+	// DefaultTighteningRatio is the tightening ratio of a ScalableBloomFilter when none is provided.
+	DefaultTighteningRatio float64 = 0.85
+)
+
+// ScalableBloomFilter is a non-thread safe bloom filter data structure that grows as items are added,
+// as described in "Scalable Bloom Filters" by Almeida, Baquero, Preguiça and Hutchison.
+//
+// It is a chain of BloomFilter layers. When the last layer holds as many items as it was estimated for,
+// a new layer is added with growthFactor times the number of items and tighteningRatio times the
+// false positive rate of the previous layer. The false positive rate of the first layer is
+// fpRate * (1 - tighteningRatio), so that the compound false positive rate of all layers never
+// exceeds fpRate, no matter how many items are added.
+// Once the false positive rate of a layer would need more than MaxHashFunctions hash functions, layers are
+// clamped to MaxHashFunctions hash functions and take slightly more bits instead.
+type ScalableBloomFilter struct {
+	hasher          Hasher
+	numItems        uint64 // estimated number of items of the first layer
+	fpRate          float64
+	growthFactor    uint64
+	tighteningRatio float64
+	layers          []*BloomFilter
+	count           uint64 // number of items in the last layer
+}
+
+// ScalableBloomFilterTS is a ScalableBloomFilter structure with a RWMutex for thread safety.
+type ScalableBloomFilterTS struct {
+	sbf *ScalableBloomFilter
+	mtx sync.RWMutex
+}
+
+// Add takes a byte slice as input and adds it to the last layer of the ScalableBloomFilter structure,
+// adding a new layer first when the last one is full.
+// Byte slices that already test positive are not added again, so that they do not use up capacity.
+func (sbf *ScalableBloomFilter) Add(data []byte) {
+	if sbf.Query(data) {
+		return
+	}
+	if sbf.count >= sbf.layerNumItems(len(sbf.layers)-1) {
+		sbf.addLayer()
+	}
+	sbf.layers[len(sbf.layers)-1].Add(data)
+	sbf.count++
+}
+
+// Query tests the byte slice input's existence in any layer of the ScalableBloomFilter structure.
+// As with BloomFilter, false positives are possible, while false negatives are not.
+func (sbf *ScalableBloomFilter) Query(data []byte) bool {
+	for _, layer := range sbf.layers {
+		if layer.Query(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// layerNumItems returns the estimated number of items of layer i, clamped to MaxSize, since a layer of more items
+// would be clamped to MaxSize bits anyway and the product may be too large to be converted to uint64.
+func (sbf *ScalableBloomFilter) layerNumItems(i int) uint64 {
+	n := float64(sbf.numItems) * math.Pow(float64(sbf.growthFactor), float64(i))
+	if !(n < MaxSize) {
+		return MaxSize
+	}
+	return uint64(n)
+}
+
+// layerFPRate returns the false positive rate of layer i.
+func (sbf *ScalableBloomFilter) layerFPRate(i int) float64 {
+	return sbf.fpRate * (1 - sbf.tighteningRatio) * math.Pow(sbf.tighteningRatio, float64(i))
+}
+
+// newLayer returns layer i. Its size and number of hash functions are clamped rather than rejected, since a layer
+// must be added however tight its false positive rate gets; see clampedEstimates.
+func (sbf *ScalableBloomFilter) newLayer(i int) *BloomFilter {
+	size, numHashFunctions := clampedEstimates(sbf.layerNumItems(i), sbf.layerFPRate(i))
+	return newBloomFilter(size, numHashFunctions, sbf.hasher)
+}
+
+func (sbf *ScalableBloomFilter) addLayer() {
+	sbf.layers = append(sbf.layers, sbf.newLayer(len(sbf.layers)))
+	sbf.count = 0
+}
+
+// Add for thread safe ScalableBloomFilterTS structure serves the same purpose as Add for ScalableBloomFilter structure.
+func (sbfts *ScalableBloomFilterTS) Add(data []byte) {
+	sbfts.mtx.Lock()
+	sbfts.sbf.Add(data)
+	sbfts.mtx.Unlock()
+}
+
+// Query for thread safe ScalableBloomFilterTS structure serves the same purpose as Query for ScalableBloomFilter structure.
+func (sbfts *ScalableBloomFilterTS) Query(data []byte) bool {
+	sbfts.mtx.RLock()
+	defer sbfts.mtx.RUnlock()
+	return sbfts.sbf.Query(data)
+}
+
+// NewScalable requires estimated number of items of the first layer and the false positive rate that must hold
+// for any number of items to create a ScalableBloomFilter structure.
+// growthFactor is the ratio of estimated number of items of a layer to the previous one, and when it is 0,
+// DefaultGrowthFactor is used.
+// tighteningRatio is the ratio of false positive rate of a layer to the previous one, it must be in range of (0.0, 1.0),
+// and when it is 0, DefaultTighteningRatio is used.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewScalable(numItems uint64, fpRate float64, growthFactor uint64, tighteningRatio float64, hash1 hash.Hash64, hash2 hash.Hash64) (*ScalableBloomFilter, error) {
+	if numItems == 0 {
+		return nil, ErrInvalidNumberOfItems
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, ErrInvalidFalsePositiveRate
+	}
+	if growthFactor == 0 {
+		growthFactor = DefaultGrowthFactor
+	}
+	if tighteningRatio == 0 {
+		tighteningRatio = DefaultTighteningRatio
+	}
+	if !(tighteningRatio > 0 && tighteningRatio < 1) {
+		return nil, ErrInvalidTighteningRatio
+	}
+	if _, _, err := estimates(numItems, fpRate*(1-tighteningRatio)); err != nil {
+		return nil, err
+	}
+
+	sbf := ScalableBloomFilter{
+		hasher:          hasherOf(hash1, hash2),
+		numItems:        numItems,
+		fpRate:          fpRate,
+		growthFactor:    growthFactor,
+		tighteningRatio: tighteningRatio,
+	}
+	sbf.addLayer()
+
+	return &sbf, nil
+}
+
+// NewTSScalable returns a new ScalableBloomFilterTS structure. For more details, please see NewScalable function.
+func NewTSScalable(numItems uint64, fpRate float64, growthFactor uint64, tighteningRatio float64, hash1 hash.Hash64, hash2 hash.Hash64) (*ScalableBloomFilterTS, error) {
+	sbf, err := NewScalable(numItems, fpRate, growthFactor, tighteningRatio, hash1, hash2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScalableBloomFilterTS{sbf: sbf}, nil
+}
+
+// A serialized ScalableBloomFilter has the following layout, all integers being little endian:
+//
+//	offset  length  field
+//	0       4       magic "BLMS"
+//	4       1       format version
+//	5       3       reserved, zero
+//	8       8       estimated number of items of the first layer
+//	16      8       false positive rate, IEEE 754
+//	24      8       growth factor
+//	32      8       tightening ratio, IEEE 754
+//	40      8       number of items in the last layer
+//	48      8       number of layers
+//	56      4       CRC-32C of all preceding bytes
+//	60              layers, each encoded as a BloomFilter
+const (
+	scalableEncodingMagic   = "BLMS"
+	scalableEncodingVersion = 1
+	scalableHeaderLen       = 56
+
+	// maxScalableLayers is the largest number of layers that ReadFrom accepts. Layers grow geometrically, so it
+	// is only reached with a growth factor of 1 and is far more than any real ScalableBloomFilter has.
+	maxScalableLayers = 1 << 16
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The returned byte slice holds the parameters of the ScalableBloomFilter structure followed by every layer
+// encoded as by BloomFilter's MarshalBinary.
+func (sbf *ScalableBloomFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := sbf.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// The hash functions of the receiver are kept, and when the receiver has none, default hash functions are used.
+// ErrHashSchemeMismatch is returned when data was produced by a ScalableBloomFilter with different hash functions.
+func (sbf *ScalableBloomFilter) UnmarshalBinary(data []byte) error {
+	loaded := ScalableBloomFilter{hasher: sbf.hasher}
+	r := bytes.NewReader(data)
+	if _, err := loaded.ReadFrom(r); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return ErrInvalidEncoding
+	}
+	*sbf = loaded
+
+	return nil
+}
+
+// WriteTo implements io.WriterTo.
+// It writes the same encoding as MarshalBinary to w, streaming the bit array of each layer.
+func (sbf *ScalableBloomFilter) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	buf := make([]byte, scalableHeaderLen+checksumLen)
+	copy(buf[0:4], scalableEncodingMagic)
+	buf[4] = scalableEncodingVersion
+	binary.LittleEndian.PutUint64(buf[8:16], sbf.numItems)
+	binary.LittleEndian.PutUint64(buf[16:24], math.Float64bits(sbf.fpRate))
+	binary.LittleEndian.PutUint64(buf[24:32], sbf.growthFactor)
+	binary.LittleEndian.PutUint64(buf[32:40], math.Float64bits(sbf.tighteningRatio))
+	binary.LittleEndian.PutUint64(buf[40:48], sbf.count)
+	binary.LittleEndian.PutUint64(buf[48:56], uint64(len(sbf.layers)))
+	binary.LittleEndian.PutUint32(buf[56:60], crc32.Checksum(buf[:scalableHeaderLen], castagnoli))
+	m, err := w.Write(buf)
+	n += int64(m)
+	if err != nil {
+		return n, err
+	}
+
+	for _, layer := range sbf.layers {
+		l, err := layer.WriteTo(w)
+		n += l
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// ReadFrom implements io.ReaderFrom.
+// It reads an encoding written by WriteTo or MarshalBinary from r, stopping right after the last layer,
+// and the receiver is modified only when the whole encoding was read and verified.
+// Layers are allocated as they are read, and an encoding of more than maxScalableLayers layers is invalid.
+// The hash functions of the receiver are kept, and when the receiver has none, default hash functions are used.
+func (sbf *ScalableBloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	buf := make([]byte, scalableHeaderLen+checksumLen)
+	m, err := io.ReadFull(r, buf)
+	n += int64(m)
+	if err != nil {
+		return n, readError(err)
+	}
+	if string(buf[0:4]) != scalableEncodingMagic {
+		return n, ErrInvalidEncoding
+	}
+	if buf[4] != scalableEncodingVersion {
+		return n, ErrUnsupportedVersion
+	}
+	if crc32.Checksum(buf[:scalableHeaderLen], castagnoli) != binary.LittleEndian.Uint32(buf[56:60]) {
+		return n, ErrChecksumMismatch
+	}
+
+	loaded := ScalableBloomFilter{
+		hasher:          sbf.hasher,
+		numItems:        binary.LittleEndian.Uint64(buf[8:16]),
+		fpRate:          math.Float64frombits(binary.LittleEndian.Uint64(buf[16:24])),
+		growthFactor:    binary.LittleEndian.Uint64(buf[24:32]),
+		tighteningRatio: math.Float64frombits(binary.LittleEndian.Uint64(buf[32:40])),
+		count:           binary.LittleEndian.Uint64(buf[40:48]),
+	}
+	numLayers := binary.LittleEndian.Uint64(buf[48:56])
+	if loaded.numItems == 0 || loaded.growthFactor == 0 || numLayers == 0 || numLayers > maxScalableLayers ||
+		!(loaded.fpRate > 0.0 && loaded.fpRate < 1.0) ||
+		!(loaded.tighteningRatio > 0.0 && loaded.tighteningRatio < 1.0) {
+		return n, ErrInvalidEncoding
+	}
+	if loaded.hasher == nil {
+		loaded.hasher = fnvHasher{}
+	}
+	scheme := hashScheme(loaded.hasher)
+
+	for i := uint64(0); i < numLayers; i++ {
+		layer := &BloomFilter{hasher: loaded.hasher, hashScheme: scheme}
+		l, err := layer.ReadFrom(r)
+		n += l
+		if err != nil {
+			return n, err
+		}
+		loaded.layers = append(loaded.layers, layer)
+	}
+	*sbf = loaded
+
+	return n, nil
+}
+
+// MarshalBinary for thread safe ScalableBloomFilterTS structure serves the same purpose as MarshalBinary for ScalableBloomFilter structure.
+func (sbfts *ScalableBloomFilterTS) MarshalBinary() ([]byte, error) {
+	sbfts.mtx.RLock()
+	defer sbfts.mtx.RUnlock()
+	return sbfts.sbf.MarshalBinary()
+}
+
+// UnmarshalBinary for thread safe ScalableBloomFilterTS structure serves the same purpose as UnmarshalBinary for ScalableBloomFilter structure.
+func (sbfts *ScalableBloomFilterTS) UnmarshalBinary(data []byte) error {
+	sbfts.mtx.Lock()
+	defer sbfts.mtx.Unlock()
+	if sbfts.sbf == nil {
+		sbfts.sbf = &ScalableBloomFilter{}
+	}
+	return sbfts.sbf.UnmarshalBinary(data)
+}
+
+// WriteTo for thread safe ScalableBloomFilterTS structure serves the same purpose as WriteTo for ScalableBloomFilter structure.
+func (sbfts *ScalableBloomFilterTS) WriteTo(w io.Writer) (int64, error) {
+	sbfts.mtx.RLock()
+	defer sbfts.mtx.RUnlock()
+	return sbfts.sbf.WriteTo(w)
+}
+
+// ReadFrom for thread safe ScalableBloomFilterTS structure serves the same purpose as ReadFrom for ScalableBloomFilter structure.
+func (sbfts *ScalableBloomFilterTS) ReadFrom(r io.Reader) (int64, error) {
+	sbfts.mtx.Lock()
+	defer sbfts.mtx.Unlock()
+	if sbfts.sbf == nil {
+		sbfts.sbf = &ScalableBloomFilter{}
+	}
+	return sbfts.sbf.ReadFrom(r)
+}
@@ -0,0 +1,259 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"hash/crc64"
+	"math"
+	"testing"
+)
+
+func TestScalableBloomFilterInit(t *testing.T) {
+	tests := []struct {
+		numItems        uint64
+		fpRate          float64
+		growthFactor    uint64
+		tighteningRatio float64
+		err             error
+	}{
+		{0, 0.01, 2, 0.9, ErrInvalidNumberOfItems},
+		{100, 0.0, 2, 0.9, ErrInvalidFalsePositiveRate},
+		{100, 1.0, 2, 0.9, ErrInvalidFalsePositiveRate},
+		{100, math.NaN(), 2, 0.9, ErrInvalidFalsePositiveRate},
+		{100, 0.01, 2, 1.0, ErrInvalidTighteningRatio},
+		{100, 0.01, 2, -0.5, ErrInvalidTighteningRatio},
+		{100, 0.01, 2, math.NaN(), ErrInvalidTighteningRatio},
+		{100, 0.01, 0, 0, nil},
+		{100, 0.01, 4, 0.5, nil},
+	}
+	for _, tt := range tests {
+		sbf, err := NewScalable(tt.numItems, tt.fpRate, tt.growthFactor, tt.tighteningRatio, nil, nil)
+		if err != tt.err {
+			t.Errorf("expected error %v for %+v, actual %v", tt.err, tt, err)
+		}
+		if (sbf == nil) != (tt.err != nil) {
+			t.Errorf("unexpected scalable bloom filter %v for %+v", sbf, tt)
+		}
+		sbfts, err := NewTSScalable(tt.numItems, tt.fpRate, tt.growthFactor, tt.tighteningRatio, nil, nil)
+		if err != tt.err {
+			t.Errorf("expected error %v for %+v, actual %v", tt.err, tt, err)
+		}
+		if (sbfts == nil) != (tt.err != nil) {
+			t.Errorf("unexpected scalable bloom filter %v for %+v", sbfts, tt)
+		}
+	}
+
+	sbf, err := NewScalable(100, 0.01, 0, 0, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if sbf.growthFactor != DefaultGrowthFactor || sbf.tighteningRatio != DefaultTighteningRatio {
+		t.Errorf("expected default growth factor %v and tightening ratio %v, actual %v and %v", DefaultGrowthFactor, DefaultTighteningRatio, sbf.growthFactor, sbf.tighteningRatio)
+	}
+}
+
+func TestScalableBloomFilterFalsePositiveRate(t *testing.T) {
+	var (
+		count     = 100000
+		numItems  = uint64(1000)
+		fp        = 0.01
+		maxStrLen = 40
+		minStrLen = 30
+	)
+
+	// FNV-1 and FNV-1a are too similar for the false positive rate of the many small layers to hold,
+	// so a CRC-64 is used as the second hash function.
+	sbf, err := NewScalable(numItems, fp, 0, 0, nil, crc64.New(crc64.MakeTable(crc64.ECMA)))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	mT := make(map[string]bool)
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	for _, tt := range tests {
+		sbf.Add(tt.data)
+		mT[string(tt.data)] = true
+	}
+	if len(sbf.layers) < 2 {
+		t.Errorf("expected the scalable bloom filter to grow past its first layer, it has %v layers", len(sbf.layers))
+	}
+	for _, tt := range tests {
+		if result := sbf.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+
+	fpCount := 0
+	testFP := prepTestCases(count, minStrLen, maxStrLen)
+	for _, tt := range testFP {
+		if sbf.Query(tt.data) && !mT[string(tt.data)] {
+			fpCount++
+		}
+	}
+	actualFpRate := float64(fpCount) / float64(count)
+	acceptableFpRate := (1 + acceptableAdditionalFalsePositiveErrorRate) * fp
+	if actualFpRate > acceptableFpRate {
+		t.Errorf("expected false positive rate is %v, acceptable is %v, actual is %v - %v out of %v items\n", fp, acceptableFpRate, actualFpRate, fpCount, count)
+	}
+}
+
+func TestScalableBloomFilterMarshalBinary(t *testing.T) {
+	var (
+		count     = 10000
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	sbfts, err := NewTSScalable(100, 0.01, 0, 0, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		sbfts.Add(tt.data)
+	}
+
+	data, err := sbfts.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var loaded ScalableBloomFilter
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if len(loaded.layers) != len(sbfts.sbf.layers) || loaded.count != sbfts.sbf.count {
+		t.Errorf("expected %v layers and %v items in the last layer, actual %v and %v", len(sbfts.sbf.layers), sbfts.sbf.count, len(loaded.layers), loaded.count)
+	}
+	for _, tt := range tests {
+		if result := loaded.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := loaded.WriteTo(&buf); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("expected WriteTo and MarshalBinary to produce the same bytes")
+	}
+
+	if err := loaded.UnmarshalBinary(data[:len(data)-1]); err != ErrInvalidEncoding {
+		t.Errorf("expected error %v, actual %v", ErrInvalidEncoding, err)
+	}
+	corrupted := append([]byte(nil), data...)
+	corrupted[8] ^= 0xff
+	if err := loaded.UnmarshalBinary(corrupted); err != ErrChecksumMismatch {
+		t.Errorf("expected error %v, actual %v", ErrChecksumMismatch, err)
+	}
+
+	other, err := NewScalable(100, 0.01, 0, 0, crc64.New(crc64.MakeTable(crc64.ECMA)), nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if err := other.UnmarshalBinary(data); err != ErrHashSchemeMismatch {
+		t.Errorf("expected error %v, actual %v", ErrHashSchemeMismatch, err)
+	}
+}
+
+// A header must not make ReadFrom allocate more layers, or a layer more bits, than the stream holds.
+func TestScalableBloomFilterReadFromMalformedHeader(t *testing.T) {
+	sbf, err := NewScalable(100, 0.01, 0, 0, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	data, err := sbf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	withLayers := func(numLayers uint64, layers []byte) []byte {
+		c := append([]byte(nil), data[:scalableHeaderLen]...)
+		binary.LittleEndian.PutUint64(c[48:56], numLayers)
+		c = binary.LittleEndian.AppendUint32(c, crc32.Checksum(c, castagnoli))
+		return append(c, layers...)
+	}
+	layer := make([]byte, headerLen)
+	header{
+		version:          encodingVersion,
+		numHashFunctions: 3,
+		size:             1 << 62,
+		hashScheme:       hashScheme(fnvHasher{}),
+	}.put(layer)
+
+	tests := []struct {
+		description string
+		data        []byte
+	}{
+		{"too many layers", withLayers(maxScalableLayers+1, data[scalableHeaderLen+checksumLen:])},
+		{"1<<62 layers", withLayers(1<<62, data[scalableHeaderLen+checksumLen:])},
+		{"layer of size 1<<62", withLayers(1, layer)},
+	}
+	for _, tt := range tests {
+		var loaded ScalableBloomFilter
+		if _, err := loaded.ReadFrom(bytes.NewReader(tt.data)); err != ErrInvalidEncoding {
+			t.Errorf("%v: expected error %v, actual %v", tt.description, ErrInvalidEncoding, err)
+		}
+	}
+}
+
+// Layers whose false positive rate needs more than MaxHashFunctions hash functions are clamped rather than wrapped around.
+func TestScalableBloomFilterClampedLayers(t *testing.T) {
+	tests := prepTestCases(100, 20, 50)
+	sbf, err := NewScalable(1, 1e-70, 1, 0.5, nil, crc64.New(crc64Table))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		sbf.Add(tt.data)
+	}
+	for _, tt := range tests {
+		if result := sbf.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+	last := sbf.layers[len(sbf.layers)-1]
+	if last.numHashFunctions != MaxHashFunctions {
+		t.Errorf("expected last of %v layers to have %v hash functions, actual %v", len(sbf.layers), MaxHashFunctions, last.numHashFunctions)
+	}
+}
+
+// The estimated number of items of deep layers or large growth factors must be clamped to MaxSize rather than converted
+// from a float64 that does not fit in uint64.
+func TestScalableBloomFilterLayerNumItems(t *testing.T) {
+	tests := []struct {
+		numItems     uint64
+		growthFactor uint64
+		layer        int
+		expected     uint64
+	}{
+		{100, 2, 0, 100},
+		{100, 2, 3, 800},
+		{1 << 20, 1 << 20, 2, 1 << 60},
+		{1 << 20, 1 << 20, 3, MaxSize},
+		{100, math.MaxUint64, 2, MaxSize},
+		{1, 2, 2000, MaxSize},
+	}
+	for _, tt := range tests {
+		sbf, err := NewScalable(tt.numItems, 0.01, tt.growthFactor, 0, nil, nil)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if actual := sbf.layerNumItems(tt.layer); actual != tt.expected {
+			t.Errorf("layer %v of %v items growing by %v: expected %v items, actual %v", tt.layer, tt.numItems, tt.growthFactor, tt.expected, actual)
+		}
+	}
+}
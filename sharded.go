@@ -0,0 +1,163 @@
+package bloomfilter
+
+import (
+	"hash"
+	"math/bits"
+	"unsafe"
+)
+
+// ShardedBloomFilter is a thread safe bloom filter data structure that splits the single lock of BloomFilterTS.
+//
+// Every element is routed by the prefix of its first hash value to one of a number of independent BloomFilter shards,
+// each guarded by a RWMutex of its own, so goroutines that add or query elements of different shards do not wait
+// for each other. Elements are hashed once, before any lock is taken, so hash functions are either a stateless Hasher
+// or created by factory functions, as for AtomicBloomFilter.
+type ShardedBloomFilter struct {
+	hasher Hasher
+	shards []bloomShard
+}
+
+// bloomShard is a shard of a ShardedBloomFilter structure, padded so that the locks of neighbouring shards
+// are not on the same cache line.
+type bloomShard struct {
+	BloomFilterTS
+	_ [64 - unsafe.Sizeof(BloomFilterTS{})%64]byte
+}
+
+// shard returns the shard that the element with first hash value hash1Val is routed to.
+// The top bits of hash1Val are scaled to the number of shards, so that any number of shards is possible,
+// and the bits that locate the element within its shard are left as they are.
+func (sbf *ShardedBloomFilter) shard(hash1Val uint64) *bloomShard {
+	i, _ := bits.Mul64(hash1Val, uint64(len(sbf.shards)))
+	return &sbf.shards[i]
+}
+
+// Add takes a byte slice as input and adds it to the bit array of its shard. Only that shard is locked for writing.
+func (sbf *ShardedBloomFilter) Add(data []byte) {
+	hash1Val, hash2Val := sbf.hasher.Sum128(data)
+	s := sbf.shard(hash1Val)
+	s.mtx.Lock()
+	s.bf.addHashes(hash1Val, hash2Val)
+	s.mtx.Unlock()
+}
+
+// Query tests the byte slice input's existence in its shard and returns a boolean value.
+// Only that shard is locked for reading.
+func (sbf *ShardedBloomFilter) Query(data []byte) bool {
+	hash1Val, hash2Val := sbf.hasher.Sum128(data)
+	s := sbf.shard(hash1Val)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.bf.queryHashes(hash1Val, hash2Val)
+}
+
+// NumShards returns the number of shards of the ShardedBloomFilter structure.
+func (sbf *ShardedBloomFilter) NumShards() int {
+	return len(sbf.shards)
+}
+
+// Stats returns statistics about how saturated the ShardedBloomFilter structure is, merged across its shards.
+// Size, BitsSet, Count and Capacity are the sums of those of the shards, and EstimatedFPRate is their mean,
+// since an element that was not added is equally likely to be routed to any shard.
+// Shards are locked one at a time, so the statistics of a ShardedBloomFilter structure that is being added to
+// may not be of a single moment.
+func (sbf *ShardedBloomFilter) Stats() Stats {
+	var stats Stats
+	var fpRate float64
+	for i := range sbf.shards {
+		s := sbf.shards[i].Stats()
+		stats.Size += s.Size
+		stats.NumHashFunctions = s.NumHashFunctions
+		stats.BitsSet += s.BitsSet
+		stats.Count += s.Count
+		stats.Capacity += s.Capacity
+		fpRate += s.EstimatedFPRate
+	}
+	stats.FillRatio = float64(stats.BitsSet) / float64(stats.Size)
+	stats.EstimatedFPRate = fpRate / float64(len(sbf.shards))
+
+	return stats
+}
+
+// EstimatedCount returns the approximate number of distinct elements that were added to the ShardedBloomFilter
+// structure, which is the sum of the estimates of its shards.
+// When every bit of a shard is set, the number of elements can not be estimated and math.MaxUint64 is returned.
+func (sbf *ShardedBloomFilter) EstimatedCount() uint64 {
+	var n float64
+	for i := range sbf.shards {
+		s := &sbf.shards[i]
+		s.mtx.RLock()
+		n += estimateCount(s.bf.size, s.bf.numHashFunctions, s.bf.bitsSet)
+		s.mtx.RUnlock()
+	}
+	return roundCount(n)
+}
+
+// Merge implements Merger. other must be a ShardedBloomFilter structure with the same number of shards,
+// created with the same estimates and hash functions, whose shards are united with the shards of the
+// ShardedBloomFilter structure one pair at a time; ErrIncompatibleFilters is returned for any other filter.
+func (sbf *ShardedBloomFilter) Merge(other Filter) error {
+	o, ok := other.(*ShardedBloomFilter)
+	if !ok || len(o.shards) != len(sbf.shards) {
+		return ErrIncompatibleFilters
+	}
+	// size, number of hash functions and hash functions never change, so they are compared without locks
+	for i := range sbf.shards {
+		if !sbf.shards[i].bf.compatible(o.shards[i].bf) {
+			return ErrIncompatibleFilters
+		}
+	}
+	for i := range sbf.shards {
+		if err := sbf.shards[i].Union(&o.shards[i].BloomFilterTS); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewShardedByEstimates returns a new ShardedBloomFilter structure of numShards shards for estimated number of items
+// and estimated false positive rate of the whole structure. Each shard is created as by NewByEstimates for
+// numItems/numShards items, rounded up, and fpRate, so the shards together take about as many bits as a single
+// BloomFilter structure would, and elements that are spread evenly across them are queried at fpRate.
+// ErrInvalidNumberOfShards is returned when numShards is 0, and the errors of NewByEstimates are returned for the
+// estimates. newHash1 and newHash2 create the hash functions, and when they are nil, default hash functions are used.
+func NewShardedByEstimates(numItems uint64, fpRate float64, numShards uint32, newHash1 func() hash.Hash64, newHash2 func() hash.Hash64) (*ShardedBloomFilter, error) {
+	return NewShardedByEstimatesWithHasher(numItems, fpRate, numShards, newHasher(newHash1, newHash2))
+}
+
+// NewShardedByEstimatesWithHasher returns a new ShardedBloomFilter structure. For more details, please see
+// NewShardedByEstimates function. h can be nil and when it is nil, the Hasher returned by NewFNVHasher will be used.
+func NewShardedByEstimatesWithHasher(numItems uint64, fpRate float64, numShards uint32, h Hasher) (*ShardedBloomFilter, error) {
+	o := newOptions(WithEstimates(numItems, fpRate), WithHasher(h))
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if _, _, err := estimates(numItems, fpRate); err != nil {
+		return nil, err
+	}
+	if numShards == 0 {
+		return nil, ErrInvalidNumberOfShards
+	}
+	if h == nil {
+		h = fnvHasher{}
+	}
+
+	perShard := numItems / uint64(numShards)
+	if numItems%uint64(numShards) > 0 {
+		perShard++
+	}
+	sbf := ShardedBloomFilter{
+		hasher: h,
+		shards: make([]bloomShard, numShards),
+	}
+	for i := range sbf.shards {
+		o := newOptions(WithEstimates(perShard, fpRate), WithHasher(h))
+		bf, err := o.build()
+		if err != nil {
+			return nil, err
+		}
+		sbf.shards[i].bf = bf
+	}
+
+	return &sbf, nil
+}
@@ -0,0 +1,258 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestShardedBloomFilterInit(t *testing.T) {
+	tests := []struct {
+		description string
+		numItems    uint64
+		fpRate      float64
+		numShards   uint32
+		err         error
+	}{
+		{"zero items", 0, 0.01, 8, ErrInvalidNumberOfItems},
+		{"false positive rate of 1", 1000, 1.0, 8, ErrInvalidFalsePositiveRate},
+		{"false positive rate of NaN", 1000, math.NaN(), 8, ErrInvalidFalsePositiveRate},
+		{"zero shards", 1000, 0.01, 0, ErrInvalidNumberOfShards},
+		{"overflow", math.MaxUint64, 0.01, 8, ErrSizeOverflow},
+	}
+	for _, tt := range tests {
+		if sbf, err := NewShardedByEstimates(tt.numItems, tt.fpRate, tt.numShards, nil, nil); sbf != nil || err != tt.err {
+			t.Errorf("%v: expected nil sharded bloom filter and error %v, actual %v and %v", tt.description, tt.err, sbf, err)
+		}
+	}
+
+	// fewer items than shards still give every shard room for one
+	sbf, err := NewShardedByEstimates(3, 0.01, 8, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if stats := sbf.Stats(); sbf.NumShards() != 8 || stats.Capacity != 8 {
+		t.Errorf("expected 8 shards with a capacity of 8, actual %v shards and %+v", sbf.NumShards(), stats)
+	}
+}
+
+// Each shard is sized for its share of the items, so the shards together must be about as large as a single
+// BloomFilter, and elements must be spread evenly enough for the false positive rate to stay close to fp.
+func TestShardedBloomFilter(t *testing.T) {
+	var (
+		count     = 100000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	negatives := prepTestCases(count, minStrLen, maxStrLen)
+
+	for _, numShards := range []uint32{1, 7, 64} {
+		sbf, err := NewShardedByEstimatesWithHasher(numItems, fp, numShards, NewXXHasher(0))
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		bf, err := NewByEstimatesWithHasher(numItems, fp, NewXXHasher(0))
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		stats := sbf.Stats()
+		if size := bf.Stats().Size; stats.Size < size || float64(stats.Size) > 1.01*float64(size) {
+			t.Errorf("%v shards: expected about %v bits, actual %v", numShards, size, stats.Size)
+		}
+
+		for _, tt := range tests {
+			sbf.Add(tt.data)
+		}
+		for _, tt := range tests {
+			if result := sbf.Query(tt.data); !result {
+				t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+			}
+		}
+
+		fps := 0
+		for _, tt := range negatives {
+			if sbf.Query(tt.data) {
+				fps++
+			}
+		}
+		if rate := float64(fps) / float64(count); rate > fp*(1+acceptableAdditionalFalsePositiveErrorRate) {
+			t.Errorf("%v shards: expected false positive rate close to %v, actual %v", numShards, fp, rate)
+		}
+
+		// every shard must get close to its share of the elements
+		for i := range sbf.shards {
+			c := sbf.shards[i].bf.count
+			if share := float64(count) / float64(numShards); math.Abs(float64(c)-share) > 6*math.Sqrt(share) {
+				t.Errorf("%v shards: expected about %v elements in shard %v, actual %v", numShards, share, i, c)
+			}
+		}
+	}
+}
+
+// Stats must merge the statistics of all shards.
+func TestShardedBloomFilterStats(t *testing.T) {
+	sbf, err := NewShardedByEstimatesWithHasher(10000, 0.01, 4, NewXXHasher(0))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for i := 0; i < 5000; i++ {
+		sbf.Add([]byte(fmt.Sprintf("data-%v", i)))
+	}
+
+	var expected Stats
+	var fpRate float64
+	for i := range sbf.shards {
+		s := sbf.shards[i].bf.Stats()
+		expected.Size += s.Size
+		expected.NumHashFunctions = s.NumHashFunctions
+		expected.BitsSet += s.BitsSet
+		expected.Count += s.Count
+		expected.Capacity += s.Capacity
+		fpRate += s.EstimatedFPRate
+	}
+	expected.FillRatio = float64(expected.BitsSet) / float64(expected.Size)
+	expected.EstimatedFPRate = fpRate / 4
+
+	if stats := sbf.Stats(); stats != expected {
+		t.Errorf("Stats: expected %+v, actual %+v", expected, stats)
+	}
+	if stats := sbf.Stats(); stats.Count != 5000 || stats.Capacity < 10000 {
+		t.Errorf("Stats: expected a count of 5000 and a capacity of at least 10000, actual %+v", stats)
+	}
+	if n := sbf.EstimatedCount(); math.Abs(float64(n)-5000) > 5000*0.05 {
+		t.Errorf("EstimatedCount: expected about %v, actual %v", 5000, n)
+	}
+}
+
+func TestShardedBloomFilterMerge(t *testing.T) {
+	newSharded := func(numShards uint32, h Hasher) *ShardedBloomFilter {
+		sbf, err := NewShardedByEstimatesWithHasher(1000, 0.01, numShards, h)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		return sbf
+	}
+
+	a, b := newSharded(4, NewXXHasher(0)), newSharded(4, NewXXHasher(0))
+	a.Add([]byte("a"))
+	b.Add([]byte("b"))
+	if err := a.Merge(b); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, data := range []string{"a", "b"} {
+		if result := a.Query([]byte(data)); !result {
+			t.Errorf("Query(%v) after Merge: expected %v, actual %v", data, true, false)
+		}
+	}
+
+	bf, _ := NewByEstimatesWithHasher(1000, 0.01, NewXXHasher(0))
+	others := []struct {
+		description string
+		other       Filter
+	}{
+		{"BloomFilter", bf},
+		{"number of shards", newSharded(5, NewXXHasher(0))},
+		{"hash functions", newSharded(4, NewXXHasher(1))},
+	}
+	for _, tt := range others {
+		if err := a.Merge(tt.other); err != ErrIncompatibleFilters {
+			t.Errorf("Merge of %v: expected error %v, actual %v", tt.description, ErrIncompatibleFilters, err)
+		}
+	}
+}
+
+// This test should NOT fail when "go test -race" command is issued.
+// ShardedBloomFilter structure is thread safe, including concurrent merges in opposite order.
+func TestShardedBloomFilterParallel(t *testing.T) {
+	var (
+		count      = 100000
+		numItems   = uint64(count)
+		fp         = 0.01
+		maxStrLen  = 50
+		minStrLen  = 20
+		goroutines = 8
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+
+	sbf, err := NewShardedByEstimates(numItems, fp, 16, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	other, err := NewShardedByEstimates(numItems, fp, 16, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < count; i += goroutines {
+				sbf.Add(tests[i].data)
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < count; i += goroutines {
+				sbf.Query(tests[(i+count/2)%count].data)
+			}
+		}(g)
+	}
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		sbf.Stats()
+	}()
+	go func() {
+		defer wg.Done()
+		sbf.Merge(other)
+	}()
+	go func() {
+		defer wg.Done()
+		other.Merge(sbf)
+	}()
+	wg.Wait()
+
+	for _, tt := range tests {
+		if result := sbf.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+}
+
+// The parallel benchmarks show how a ShardedBloomFilter scales with GOMAXPROCS compared to a BloomFilterTS,
+// whose single lock every goroutine waits for:
+//
+//	go test -run NONE -bench 'Parallel(Add|Query)(TS|Sharded)' -cpu 1,2,4,8
+func BenchmarkParallelAddSharded(b *testing.B) {
+	sbf, err := NewShardedByEstimates(1000000, 0.01, 64, nil, nil)
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+	benchmarkParallel(b, sbf.Add)
+}
+
+func BenchmarkParallelQuerySharded(b *testing.B) {
+	sbf, err := NewShardedByEstimates(1000000, 0.01, 64, nil, nil)
+	if err != nil {
+		b.Log(err.Error())
+		b.FailNow()
+	}
+	benchmarkParallel(b, func(data []byte) { sbf.Query(data) })
+}
@@ -0,0 +1,84 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// sipHasher computes the 128-bit output of SipHash-2-4 keyed with k0 and k1.
+type sipHasher struct {
+	k0 uint64
+	k1 uint64
+}
+
+// NewSipHasher returns a Hasher based on SipHash-2-4 with 128-bit output, keyed with k0 and k1,
+// which are the first and the last 8 bytes of the 16-byte key read as little-endian integers.
+// SipHash is slower than NewXXHasher, but when the key is secret, an adversary who chooses the elements
+// can not predict their locations, and therefore can not craft elements that raise the false positive rate.
+// Bloom filters that are going to be combined or loaded from an encoding must use the same key.
+func NewSipHasher(k0 uint64, k1 uint64) Hasher {
+	return sipHasher{k0: k0, k1: k1}
+}
+
+func (sh sipHasher) Sum128(data []byte) (uint64, uint64) {
+	return sipHash128(sh.k0, sh.k1, data)
+}
+
+// sipHash128 returns the two halves of the 128-bit SipHash-2-4 of data keyed with k0 and k1,
+// as specified by https://github.com/veorq/SipHash.
+func sipHash128(k0 uint64, k1 uint64, data []byte) (uint64, uint64) {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d ^ 0xee
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	n := len(data)
+	for ; len(data) >= 8; data = data[8:] {
+		m := binary.LittleEndian.Uint64(data)
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+	}
+
+	m := uint64(n) << 56
+	for i, c := range data {
+		m |= uint64(c) << (8 * uint(i))
+	}
+	v3 ^= m
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= m
+
+	v2 ^= 0xee
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	hash1Val := v0 ^ v1 ^ v2 ^ v3
+
+	v1 ^= 0xdd
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	hash2Val := v0 ^ v1 ^ v2 ^ v3
+
+	return hash1Val, hash2Val
+}
+
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = bits.RotateLeft64(v1, 13)
+	v1 ^= v0
+	v0 = bits.RotateLeft64(v0, 32)
+	v2 += v3
+	v3 = bits.RotateLeft64(v3, 16)
+	v3 ^= v2
+	v0 += v3
+	v3 = bits.RotateLeft64(v3, 21)
+	v3 ^= v0
+	v2 += v1
+	v1 = bits.RotateLeft64(v1, 17)
+	v1 ^= v2
+	v2 = bits.RotateLeft64(v2, 32)
+	return v0, v1, v2, v3
+}
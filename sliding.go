@@ -0,0 +1,233 @@
+package bloomfilter
+
+import (
+	"hash"
+	"math"
+	"sync"
+	"time"
+)
+
+// MaxGenerations is the largest number of generations of a SlidingWindowBloomFilter, which limits how much smaller
+// than its window its granularity can be.
+const MaxGenerations = 1024
+
+// SlidingWindowBloomFilter is a non-thread safe bloom filter data structure that only holds the elements that were added
+// within a sliding window of time, such as the last 10 minutes, rather than every element that was ever added.
+//
+// It is a ring of BloomFilter generations, each of which covers a time slice of granularity. Add writes to the
+// generation of the current time slice, and once the time slice ends, the oldest generation is cleared and reused
+// for the next one. Query checks every generation whose time slice is still within the window, so an element is found
+// for at least window and at most window plus granularity after it is added; a smaller granularity expires elements
+// more precisely, at the cost of more generations.
+// Time is read from a clock function, so that tests can control it.
+type SlidingWindowBloomFilter struct {
+	granularity time.Duration
+	now         func() time.Time
+	numItems    uint64         // estimated number of items in a window
+	generations []*BloomFilter // ring of generations, the current one at index current
+	current     int
+	start       time.Time // start of the time slice of the current generation
+}
+
+// SlidingWindowBloomFilterTS is a SlidingWindowBloomFilter structure with a RWMutex for thread safety.
+type SlidingWindowBloomFilterTS struct {
+	swbf *SlidingWindowBloomFilter
+	mtx  sync.RWMutex
+}
+
+// elapsed returns the number of time slices that ended since the current generation's time slice started,
+// up to the number of generations. A clock that goes backwards is taken as no time passing.
+func (swbf *SlidingWindowBloomFilter) elapsed() int {
+	d := swbf.now().Sub(swbf.start)
+	if d < swbf.granularity {
+		return 0
+	}
+	if n := d / swbf.granularity; n < time.Duration(len(swbf.generations)) {
+		return int(n)
+	}
+	return len(swbf.generations)
+}
+
+// live returns the number of generations, counting back from the current one, whose time slices are within the window.
+func (swbf *SlidingWindowBloomFilter) live() int {
+	return len(swbf.generations) - swbf.elapsed()
+}
+
+// generation returns the i-th generation counting back from the current one.
+func (swbf *SlidingWindowBloomFilter) generation(i int) *BloomFilter {
+	n := len(swbf.generations)
+	return swbf.generations[(swbf.current-i+n)%n]
+}
+
+// rotate moves the current generation forward to the current time slice, clearing every generation that it moves to.
+func (swbf *SlidingWindowBloomFilter) rotate() {
+	d := swbf.now().Sub(swbf.start)
+	if d < swbf.granularity {
+		return
+	}
+	slices := d / swbf.granularity
+	for i := time.Duration(0); i < slices && i < time.Duration(len(swbf.generations)); i++ {
+		swbf.current = (swbf.current + 1) % len(swbf.generations)
+		swbf.generations[swbf.current].reset()
+	}
+	swbf.start = swbf.start.Add(slices * swbf.granularity)
+}
+
+// Add takes a byte slice as input and adds it to the generation of the current time slice,
+// clearing the generations whose time slices left the window first.
+func (swbf *SlidingWindowBloomFilter) Add(data []byte) {
+	swbf.rotate()
+	swbf.generations[swbf.current].Add(data)
+}
+
+// Query tests whether the byte slice input was added to the SlidingWindowBloomFilter structure within the window.
+// As with BloomFilter, false positives are possible, while false negatives are not.
+// Query does not clear any generation, so it only reads the SlidingWindowBloomFilter structure.
+func (swbf *SlidingWindowBloomFilter) Query(data []byte) bool {
+	hash1Val, hash2Val := swbf.generations[0].hasher.Sum128(data)
+	for i, live := 0, swbf.live(); i < live; i++ {
+		if swbf.generation(i).queryHashes(hash1Val, hash2Val) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns statistics about how saturated the SlidingWindowBloomFilter structure is.
+// Size is the size of all generations together, while BitsSet, FillRatio and Count only take the generations
+// within the window into account, and EstimatedFPRate is the probability that any of them returns a false positive.
+// Capacity is the estimated number of items in a window.
+func (swbf *SlidingWindowBloomFilter) Stats() Stats {
+	stats := Stats{
+		NumHashFunctions: swbf.generations[0].numHashFunctions,
+		Capacity:         swbf.numItems,
+	}
+	for _, g := range swbf.generations {
+		stats.Size += g.size
+	}
+
+	var liveSize uint64
+	notFP := 1.0
+	for i, live := 0, swbf.live(); i < live; i++ {
+		g := swbf.generation(i)
+		liveSize += g.size
+		stats.BitsSet += g.bitsSet
+		stats.Count += g.count
+		notFP *= 1 - g.estimatedFPRate()
+	}
+	if liveSize > 0 {
+		stats.FillRatio = float64(stats.BitsSet) / float64(liveSize)
+	}
+	stats.EstimatedFPRate = 1 - notFP
+
+	return stats
+}
+
+// reset clears the bit array and the number of Add calls of the BloomFilter structure.
+// A false positive rate threshold stays set and may be reached again.
+func (bf *BloomFilter) reset() {
+	for i := range bf.bits {
+		bf.bits[i] = 0
+	}
+	bf.bitsSet, bf.count, bf.thresholdFired = 0, 0, false
+}
+
+// Add for thread safe SlidingWindowBloomFilterTS structure serves the same purpose as Add for SlidingWindowBloomFilter structure.
+func (swbfts *SlidingWindowBloomFilterTS) Add(data []byte) {
+	swbfts.mtx.Lock()
+	swbfts.swbf.Add(data)
+	swbfts.mtx.Unlock()
+}
+
+// Query for thread safe SlidingWindowBloomFilterTS structure serves the same purpose as Query for SlidingWindowBloomFilter
+// structure. Query only reads the structure, so it is locked for reading.
+func (swbfts *SlidingWindowBloomFilterTS) Query(data []byte) bool {
+	swbfts.mtx.RLock()
+	defer swbfts.mtx.RUnlock()
+	return swbfts.swbf.Query(data)
+}
+
+// Stats for thread safe SlidingWindowBloomFilterTS structure serves the same purpose as Stats for SlidingWindowBloomFilter structure.
+func (swbfts *SlidingWindowBloomFilterTS) Stats() Stats {
+	swbfts.mtx.RLock()
+	defer swbfts.mtx.RUnlock()
+	return swbfts.swbf.Stats()
+}
+
+// NewSlidingWindow requires estimated number of items that are added within a window of time and the false positive rate
+// of a Query to create a SlidingWindowBloomFilter structure that holds elements for window.
+// granularity is the length of the time slice of each generation and must be in range of (0, window], and window
+// must not be more than MaxGenerations-1 times granularity; otherwise ErrInvalidWindow is returned.
+// There is a generation for every granularity in window and one more, so that the whole window is always covered.
+// Each generation is created as by NewByEstimates for its share of numItems, assuming that items are added at a steady
+// rate, and fpRate divided by the number of generations, so that a Query of all of them is false positive at fpRate.
+// now is the clock, and when it is nil, time.Now is used.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewSlidingWindow(numItems uint64, fpRate float64, window time.Duration, granularity time.Duration, now func() time.Time, hash1 hash.Hash64, hash2 hash.Hash64) (*SlidingWindowBloomFilter, error) {
+	return NewSlidingWindowWithHasher(numItems, fpRate, window, granularity, now, hasherOf(hash1, hash2))
+}
+
+// NewSlidingWindowWithHasher returns a new SlidingWindowBloomFilter structure. For more details, please see
+// NewSlidingWindow function. h can be nil and when it is nil, the Hasher returned by NewFNVHasher will be used.
+func NewSlidingWindowWithHasher(numItems uint64, fpRate float64, window time.Duration, granularity time.Duration, now func() time.Time, h Hasher) (*SlidingWindowBloomFilter, error) {
+	if numItems == 0 {
+		return nil, ErrInvalidNumberOfItems
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, ErrInvalidFalsePositiveRate
+	}
+	if window <= 0 || granularity <= 0 || granularity > window {
+		return nil, ErrInvalidWindow
+	}
+	slices := window / granularity
+	if window%granularity > 0 {
+		slices++
+	}
+	if slices >= MaxGenerations {
+		return nil, ErrInvalidWindow
+	}
+	if now == nil {
+		now = time.Now
+	}
+
+	numGenerations := int(slices) + 1
+	perGeneration := uint64(math.Ceil(float64(numItems) / float64(slices)))
+	o := newOptions(WithEstimates(perGeneration, fpRate/float64(numGenerations)), WithHasher(h))
+	swbf := SlidingWindowBloomFilter{
+		granularity: granularity,
+		now:         now,
+		numItems:    numItems,
+		generations: make([]*BloomFilter, numGenerations),
+	}
+	for i := range swbf.generations {
+		bf, err := o.build()
+		if err != nil {
+			return nil, err
+		}
+		swbf.generations[i] = bf
+	}
+	swbf.start = now()
+
+	return &swbf, nil
+}
+
+// NewTSSlidingWindow returns a new SlidingWindowBloomFilterTS structure. For more details, please see NewSlidingWindow function.
+func NewTSSlidingWindow(numItems uint64, fpRate float64, window time.Duration, granularity time.Duration, now func() time.Time, hash1 hash.Hash64, hash2 hash.Hash64) (*SlidingWindowBloomFilterTS, error) {
+	swbf, err := NewSlidingWindow(numItems, fpRate, window, granularity, now, hash1, hash2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SlidingWindowBloomFilterTS{swbf: swbf}, nil
+}
+
+// NewTSSlidingWindowWithHasher returns a new SlidingWindowBloomFilterTS structure.
+// For more details, please see NewSlidingWindowWithHasher function.
+func NewTSSlidingWindowWithHasher(numItems uint64, fpRate float64, window time.Duration, granularity time.Duration, now func() time.Time, h Hasher) (*SlidingWindowBloomFilterTS, error) {
+	swbf, err := NewSlidingWindowWithHasher(numItems, fpRate, window, granularity, now, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SlidingWindowBloomFilterTS{swbf: swbf}, nil
+}
@@ -0,0 +1,234 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a clock for sliding window bloom filters that only moves when it is advanced.
+type testClock struct {
+	mtx sync.Mutex
+	t   time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// stoppedClock always returns the same time, so sliding window bloom filters that use it never expire elements.
+func stoppedClock() time.Time {
+	return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestSlidingWindowBloomFilterInit(t *testing.T) {
+	tests := []struct {
+		description string
+		numItems    uint64
+		fpRate      float64
+		window      time.Duration
+		granularity time.Duration
+		err         error
+	}{
+		{"zero items", 0, 0.01, time.Minute, time.Second, ErrInvalidNumberOfItems},
+		{"false positive rate of 1", 1000, 1.0, time.Minute, time.Second, ErrInvalidFalsePositiveRate},
+		{"false positive rate of NaN", 1000, math.NaN(), time.Minute, time.Second, ErrInvalidFalsePositiveRate},
+		{"zero window", 1000, 0.01, 0, time.Second, ErrInvalidWindow},
+		{"zero granularity", 1000, 0.01, time.Minute, 0, ErrInvalidWindow},
+		{"negative granularity", 1000, 0.01, time.Minute, -time.Second, ErrInvalidWindow},
+		{"granularity longer than window", 1000, 0.01, time.Second, time.Minute, ErrInvalidWindow},
+		{"too many generations", 1000, 0.01, time.Hour, time.Second, ErrInvalidWindow},
+		{"too many hash functions", 1000, 1e-76, time.Minute, time.Second, ErrTooManyHashFunctions},
+	}
+	for _, tt := range tests {
+		if swbf, err := NewSlidingWindow(tt.numItems, tt.fpRate, tt.window, tt.granularity, nil, nil, nil); swbf != nil || err != tt.err {
+			t.Errorf("%v: expected nil sliding window bloom filter and error %v, actual %v and %v", tt.description, tt.err, swbf, err)
+		}
+	}
+
+	// a window that is not a multiple of granularity is rounded up to one
+	swbf, err := NewSlidingWindow(1000, 0.01, 10*time.Minute+time.Second, time.Minute, nil, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if n := len(swbf.generations); n != 12 {
+		t.Errorf("expected %v generations, actual %v", 12, n)
+	}
+	if _, err := NewSlidingWindow(1000, 0.01, (MaxGenerations-1)*time.Second, time.Second, nil, nil, nil); err != nil {
+		t.Errorf("%v generations: expected nil error, actual %v", MaxGenerations, err)
+	}
+}
+
+// An element must be found for at least window and at most window plus granularity after it is added.
+func TestSlidingWindowBloomFilterExpiry(t *testing.T) {
+	clock := newTestClock()
+	swbf, err := NewSlidingWindow(1000, 0.01, 10*time.Minute, time.Minute, clock.Now, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	clock.advance(30 * time.Second)
+	swbf.Add([]byte("first"))
+	clock.advance(5 * time.Minute)
+	swbf.Add([]byte("second"))
+
+	steps := []struct {
+		advance time.Duration
+		data    string
+		exists  bool
+	}{
+		// the time is 5m30s after "first" was added
+		{0, "first", true},
+		{0, "second", true},
+		{4*time.Minute + 59*time.Second, "first", true},
+		{time.Second, "first", true}, // window
+		{29 * time.Second, "first", true},
+		{time.Second, "first", false}, // window plus the rest of its time slice
+		{0, "second", true},
+		{5 * time.Minute, "second", false},
+	}
+	for i, st := range steps {
+		clock.advance(st.advance)
+		if result := swbf.Query([]byte(st.data)); result != st.exists {
+			t.Errorf("step %v: Query(%v): expected %v, actual %v", i, st.data, st.exists, result)
+		}
+	}
+	if stats := swbf.Stats(); stats.Count != 0 || stats.BitsSet != 0 || stats.EstimatedFPRate != 0 {
+		t.Errorf("expected no element within the window, actual %+v", stats)
+	}
+
+	// a generation that is reused must not keep the elements of its previous time slice
+	swbf.Add([]byte("third"))
+	for _, data := range []string{"first", "second"} {
+		if result := swbf.Query([]byte(data)); result {
+			t.Errorf("Query(%v) after Add: expected %v, actual %v", data, false, true)
+		}
+	}
+	if stats := swbf.Stats(); stats.Count != 1 {
+		t.Errorf("expected a count of 1, actual %v", stats.Count)
+	}
+}
+
+// A clock that goes backwards must neither expire nor resurrect elements.
+func TestSlidingWindowBloomFilterClockBackwards(t *testing.T) {
+	clock := newTestClock()
+	swbf, err := NewSlidingWindow(1000, 0.01, 10*time.Minute, time.Minute, clock.Now, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	swbf.Add([]byte("data"))
+	clock.advance(-time.Hour)
+	swbf.Add([]byte("more data"))
+	for _, data := range []string{"data", "more data"} {
+		if result := swbf.Query([]byte(data)); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", data, true, false)
+		}
+	}
+}
+
+// Elements added at a steady rate must be queried at about fpRate, however many generations are within the window.
+func TestSlidingWindowBloomFilterFalsePositiveRate(t *testing.T) {
+	var (
+		count     = 100000
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(2*count, minStrLen, maxStrLen)
+	negatives := prepTestCases(count, minStrLen, maxStrLen)
+
+	clock := newTestClock()
+	swbf, err := NewSlidingWindowWithHasher(uint64(count), fp, 10*time.Minute, time.Minute, clock.Now, NewXXHasher(0))
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	// two windows of elements, of which only the last one is within the window
+	step := 20 * time.Minute / time.Duration(len(tests))
+	for _, tt := range tests {
+		swbf.Add(tt.data)
+		clock.advance(step)
+	}
+	for i, tt := range tests[len(tests)-count:] {
+		if result := swbf.Query(tt.data); !result {
+			t.Errorf("Query(%v) of element %v: expected %v, actual %v", string(tt.data), i, true, false)
+			break
+		}
+	}
+
+	fps := 0
+	for _, tt := range negatives {
+		if swbf.Query(tt.data) {
+			fps++
+		}
+	}
+	if rate := float64(fps) / float64(count); rate > fp*(1+acceptableAdditionalFalsePositiveErrorRate) {
+		t.Errorf("expected false positive rate close to %v, actual %v", fp, rate)
+	}
+	if stats := swbf.Stats(); stats.EstimatedFPRate > fp*(1+acceptableAdditionalFalsePositiveErrorRate) || stats.Capacity != uint64(count) {
+		t.Errorf("expected estimated false positive rate close to %v and a capacity of %v, actual %+v", fp, count, stats)
+	}
+}
+
+// This test should NOT fail when "go test -race" command is issued.
+// SlidingWindowBloomFilterTS structure is thread safe, including while generations are rotated.
+func TestSlidingWindowBloomFilterTSParallel(t *testing.T) {
+	var (
+		count      = 10000
+		goroutines = 8
+	)
+
+	clock := newTestClock()
+	swbfts, err := NewTSSlidingWindow(uint64(count), 0.01, time.Minute, time.Second, clock.Now, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < count; i += goroutines {
+				swbfts.Add([]byte(fmt.Sprintf("data-%v", i)))
+				if i%100 == 0 {
+					clock.advance(100 * time.Millisecond)
+				}
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < count; i += goroutines {
+				swbfts.Query([]byte(fmt.Sprintf("data-%v", i)))
+				swbfts.Stats()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// the clock moved forward by 10 seconds, which is well within the window
+	for i := 0; i < count; i++ {
+		if result := swbfts.Query([]byte(fmt.Sprintf("data-%v", i))); !result {
+			t.Errorf("Query(data-%v): expected %v, actual %v", i, true, false)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	// splitBlockBytes is the size of a block of SplitBlockBloomFilter in bytes.
+	splitBlockBytes = 32
+
+	// minSplitBlockBytes and maxSplitBlockBytes are the limits of the size of the bitset of a SplitBlockBloomFilter
+	// in bytes that Parquet implementations accept.
+	minSplitBlockBytes = splitBlockBytes
+	maxSplitBlockBytes = 128 * 1024 * 1024
+)
+
+// splitBlockSalts are the salts of the split block bloom filter algorithm of the Parquet format.
+var splitBlockSalts = [8]uint32{
+	0x47b6137b, 0x44974d91, 0x8824ad5b, 0xa2b7289d,
+	0x705495c7, 0x2df1424b, 0x9efc4947, 0x5c6bfb31,
+}
+
+// splitBlock is a 256-bit block of eight 32-bit words.
+type splitBlock [8]uint32
+
+// insert sets one bit in every word of the block for x.
+func (b *splitBlock) insert(x uint32) {
+	for i, salt := range splitBlockSalts {
+		b[i] |= 1 << ((x * salt) >> 27)
+	}
+}
+
+// check reports whether the bit of every word of the block for x is set.
+func (b *splitBlock) check(x uint32) bool {
+	for i, salt := range splitBlockSalts {
+		if b[i]&(1<<((x*salt)>>27)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitBlockBloomFilter is a non-thread safe bloom filter data structure that implements the split block
+// bloom filter of the Parquet format, as specified by https://github.com/apache/parquet-format/blob/master/BloomFilter.md.
+//
+// Its bitset is made of 256-bit blocks of eight 32-bit words. An element selects a block by the upper 32 bits
+// of its hash value, and sets one bit in every word of the block, selected by the lower 32 bits multiplied by a salt.
+// Elements are hashed with XXH64 and seed 0, so the bitset returned by MarshalBinary can be written to and read from
+// Parquet files as the bloom filter of a column, whose values must be passed in their plain encoding.
+type SplitBlockBloomFilter struct {
+	blocks []splitBlock
+}
+
+// Add takes a byte slice as input, which is a value in its Parquet plain encoding, and adds it
+// to the SplitBlockBloomFilter structure.
+func (sbbf *SplitBlockBloomFilter) Add(data []byte) {
+	sbbf.AddHash(xxh64(data, 0))
+}
+
+// AddHash adds an element by its XXH64 hash value with seed 0, for callers that already have it.
+func (sbbf *SplitBlockBloomFilter) AddHash(h uint64) {
+	sbbf.block(h).insert(uint32(h))
+}
+
+// Query tests the byte slice input's existence in the SplitBlockBloomFilter structure and returns a boolean value.
+// As with BloomFilter, false positives are possible, while false negatives are not.
+func (sbbf *SplitBlockBloomFilter) Query(data []byte) bool {
+	return sbbf.QueryHash(xxh64(data, 0))
+}
+
+// QueryHash tests an element's existence by its XXH64 hash value with seed 0.
+func (sbbf *SplitBlockBloomFilter) QueryHash(h uint64) bool {
+	return sbbf.block(h).check(uint32(h))
+}
+
+// block returns the block of an element whose hash value is h.
+func (sbbf *SplitBlockBloomFilter) block(h uint64) *splitBlock {
+	return &sbbf.blocks[((h>>32)*uint64(len(sbbf.blocks)))>>32]
+}
+
+// NumBytes returns the size of the bitset of the SplitBlockBloomFilter structure in bytes,
+// which is the length of the byte slice returned by MarshalBinary.
+func (sbbf *SplitBlockBloomFilter) NumBytes() uint64 {
+	return uint64(len(sbbf.blocks)) * splitBlockBytes
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The returned byte slice is the bitset in the layout of the Parquet format: blocks one after another,
+// each as eight little endian 32-bit words. Unlike the encoding of BloomFilter, it has no header or checksum,
+// since Parquet keeps the size and the algorithm in the header of the bloom filter.
+func (sbbf *SplitBlockBloomFilter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, sbbf.NumBytes())
+	for i := range sbbf.blocks {
+		for j, w := range sbbf.blocks[i] {
+			binary.LittleEndian.PutUint32(data[i*splitBlockBytes+4*j:], w)
+		}
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// data is a bitset in the layout of the Parquet format, such as the one returned by MarshalBinary.
+// ErrInvalidEncoding is returned when the length of data is not a positive multiple of 32 bytes.
+func (sbbf *SplitBlockBloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || len(data)%splitBlockBytes != 0 {
+		return ErrInvalidEncoding
+	}
+	blocks := make([]splitBlock, len(data)/splitBlockBytes)
+	for i := range blocks {
+		for j := range blocks[i] {
+			blocks[i][j] = binary.LittleEndian.Uint32(data[i*splitBlockBytes+4*j:])
+		}
+	}
+	sbbf.blocks = blocks
+
+	return nil
+}
+
+// splitBlockNumBytes returns the number of bytes of the bitset of a SplitBlockBloomFilter that holds numItems items
+// with a false positive rate of fpRate, as calculated by Parquet implementations: -8 * numItems / ln(1 - fpRate^(1/8))
+// bits, rounded up to a power of two between 32 bytes and 128 MiB.
+func splitBlockNumBytes(numItems uint64, fpRate float64) uint64 {
+	numBits := -8 * float64(numItems) / math.Log(1-math.Pow(fpRate, 1.0/8))
+	if numBits >= maxSplitBlockBytes*8 {
+		return maxSplitBlockBytes
+	}
+	return roundSplitBlockBytes(uint64(math.Ceil(numBits / 8)))
+}
+
+// roundSplitBlockBytes rounds numBytes up to a power of two between 32 bytes and 128 MiB.
+func roundSplitBlockBytes(numBytes uint64) uint64 {
+	n := uint64(minSplitBlockBytes)
+	for n < numBytes && n < maxSplitBlockBytes {
+		n <<= 1
+	}
+	return n
+}
+
+// NewSplitBlockByEstimates requires estimated number of items and estimated false positive rate to create
+// a SplitBlockBloomFilter structure. The size of the bitset is calculated the way Parquet implementations calculate it
+// from the number of distinct values and the false positive probability, and is a power of two between
+// 32 bytes and 128 MiB; when numItems and fpRate need more, the false positive rate will be higher than fpRate.
+func NewSplitBlockByEstimates(numItems uint64, fpRate float64) (*SplitBlockBloomFilter, error) {
+	if numItems == 0 {
+		return nil, ErrInvalidNumberOfItems
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, ErrInvalidFalsePositiveRate
+	}
+
+	return NewSplitBlockBySize(splitBlockNumBytes(numItems, fpRate))
+}
+
+// NewSplitBlockBySize requires the size of the bitset in bytes to create a SplitBlockBloomFilter structure.
+// numBytes is rounded up to a power of two between 32 bytes and 128 MiB, which Parquet implementations require.
+func NewSplitBlockBySize(numBytes uint64) (*SplitBlockBloomFilter, error) {
+	if numBytes == 0 {
+		return nil, ErrInvalidSize
+	}
+	sbbf := SplitBlockBloomFilter{
+		blocks: make([]splitBlock, roundSplitBlockBytes(numBytes)/splitBlockBytes),
+	}
+
+	return &sbbf, nil
+}
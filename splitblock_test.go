@@ -0,0 +1,249 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestSplitBlockBloomFilterInit(t *testing.T) {
+	if sbbf, err := NewSplitBlockByEstimates(0, 0.01); sbbf != nil || err != ErrInvalidNumberOfItems {
+		t.Errorf("expected nil split block bloom filter and error %v, actual %v and %v", ErrInvalidNumberOfItems, sbbf, err)
+	}
+	if sbbf, err := NewSplitBlockByEstimates(100, 1.0); sbbf != nil || err != ErrInvalidFalsePositiveRate {
+		t.Errorf("expected nil split block bloom filter and error %v, actual %v and %v", ErrInvalidFalsePositiveRate, sbbf, err)
+	}
+	if sbbf, err := NewSplitBlockBySize(0); sbbf != nil || err != ErrInvalidSize {
+		t.Errorf("expected nil split block bloom filter and error %v, actual %v and %v", ErrInvalidSize, sbbf, err)
+	}
+
+	sizes := []struct {
+		numBytes uint64
+		expected uint64
+	}{
+		{1, 32},
+		{32, 32},
+		{33, 64},
+		{1000, 1024},
+		{1 << 30, maxSplitBlockBytes},
+	}
+	for _, tt := range sizes {
+		sbbf, err := NewSplitBlockBySize(tt.numBytes)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if sbbf.NumBytes() != tt.expected {
+			t.Errorf("NewSplitBlockBySize(%v): expected %v bytes, actual %v", tt.numBytes, tt.expected, sbbf.NumBytes())
+		}
+	}
+}
+
+// The number of bytes must be the one that Parquet implementations calculate from the number of distinct values
+// and the false positive probability, -8 * ndv / ln(1 - fpp^(1/8)) bits rounded up to a power of two.
+func TestSplitBlockNumBytes(t *testing.T) {
+	tests := []struct {
+		numItems uint64
+		fpRate   float64
+		expected uint64
+	}{
+		{1, 0.5, 32},
+		{1000, 0.01, 2048},
+		{1000000, 0.01, 2097152},
+		{1000000, 0.001, 2097152},
+		{1000000, 0.0001, 4194304},
+		{1000000000, 0.01, maxSplitBlockBytes},
+	}
+	for _, tt := range tests {
+		if actual := splitBlockNumBytes(tt.numItems, tt.fpRate); actual != tt.expected {
+			t.Errorf("splitBlockNumBytes(%v, %v): expected %v, actual %v", tt.numItems, tt.fpRate, tt.expected, actual)
+		}
+	}
+}
+
+// Regression cases for hash values whose block and bits are easy to work out by hand: an element selects
+// block ((h >> 32) * z) >> 32 out of z blocks and sets bit (uint32(h) * salt[i]) >> 27 of word i, and the bitset
+// is written as little endian words. They are derived from the same reading of the Parquet specification as
+// the implementation, so they guard against regressions, while TestSplitBlockBloomFilterVectors checks compatibility.
+func TestSplitBlockBloomFilterLayout(t *testing.T) {
+	tests := []struct {
+		description string
+		h           uint64
+		block       int
+		bits        [8]uint
+	}{
+		// x = 0 makes every product 0
+		{"zero", 0, 0, [8]uint{0, 0, 0, 0, 0, 0, 0, 0}},
+		// x = 1 makes every bit the upper 5 bits of the salt
+		{"one", 1, 0, [8]uint{8, 8, 17, 20, 14, 5, 19, 11}},
+		// the upper 32 bits select block (0xc0000000 * 4) >> 32 = 3
+		{"block", 0xc0000000_00000001, 3, [8]uint{8, 8, 17, 20, 14, 5, 19, 11}},
+		// x = 0x80000000 makes every product 0 or 1 << 31, and all salts are odd
+		{"high bit", 0x40000000_80000000, 1, [8]uint{16, 16, 16, 16, 16, 16, 16, 16}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			sbbf, err := NewSplitBlockBySize(4 * splitBlockBytes)
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			sbbf.AddHash(tt.h)
+			if !sbbf.QueryHash(tt.h) {
+				t.Errorf("QueryHash(%x): expected %v, actual %v", tt.h, true, false)
+			}
+
+			expected := make([]byte, 4*splitBlockBytes)
+			for i, bit := range tt.bits {
+				binary.LittleEndian.PutUint32(expected[tt.block*splitBlockBytes+4*i:], 1<<bit)
+			}
+			actual, err := sbbf.MarshalBinary()
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("MarshalBinary: expected %x, actual %x", expected, actual)
+			}
+		})
+	}
+}
+
+// The bitsets must be byte for byte the ones that an independent implementation writes for the same elements.
+// They were written by the SplitBlockFilter of github.com/parquet-go/parquet-go v0.30.1, with 8 blocks,
+// for a fixed list of hash values and for XXH64 hashes of "parquet-0" to "parquet-15".
+func TestSplitBlockBloomFilterVectors(t *testing.T) {
+	hashes := []uint64{0x0123456789abcdef, 0xfedcba9876543210, 0xdeadbeefcafebabe, 0x8000000000000001,
+		0x00000000ffffffff, 0xffffffff00000000, 0x9e3779b97f4a7c15, 0x5555555555555555}
+	tests := []struct {
+		description string
+		add         func(sbbf *SplitBlockBloomFilter)
+		expected    string
+	}{
+		{"hashes", func(sbbf *SplitBlockBloomFilter) {
+			for _, h := range hashes {
+				sbbf.AddHash(h)
+			}
+		}, "" +
+			"0000840000008800004000400008800010000200000001040010000000001001" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000040000000020100000000040000020000000000100000040000040000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0001800000010000400002000000500040400000200000800000180000080002" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000001040000000008000000100000000400000000400000100000000000040" +
+			"1100000011000000010001000100100001200000010400000100008001000008"},
+		{"elements", func(sbbf *SplitBlockBloomFilter) {
+			for i := 0; i < 16; i++ {
+				sbbf.Add([]byte(fmt.Sprintf("parquet-%v", i)))
+			}
+		}, "" +
+			"0080020160002000002001080001100200080048802080000002000310400004" +
+			"200200002004000048000000080000020000000c000010010800008000080400" +
+			"8000004002008000000001801000004010010000000108000000800100100010" +
+			"0200000000000001000040000040000000000800000000100100000010000000" +
+			"8000400010010000000008081000040000008004200000012008000000000401" +
+			"00010440002002400000220420080000000002a0000204080400110000400018" +
+			"1000040002004000020000020004400000020200002002000000200408002000" +
+			"0001000000400000008000000002000000000002000000200100000000000800"},
+	}
+	for _, tt := range tests {
+		sbbf, err := NewSplitBlockBySize(8 * splitBlockBytes)
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		tt.add(sbbf)
+		expected, _ := hex.DecodeString(tt.expected)
+		actual, err := sbbf.MarshalBinary()
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("%v: expected %x, actual %x", tt.description, expected, actual)
+		}
+	}
+}
+
+// Add must hash elements with XXH64 and seed 0, as the specification requires.
+func TestSplitBlockBloomFilterHash(t *testing.T) {
+	a, err := NewSplitBlockBySize(1024)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	b, err := NewSplitBlockBySize(1024)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	a.Add([]byte("Nobody inspects the spammish repetition"))
+	b.AddHash(0xfbcea83c8a378bf1)
+
+	encodedA, _ := a.MarshalBinary()
+	encodedB, _ := b.MarshalBinary()
+	if !bytes.Equal(encodedA, encodedB) {
+		t.Errorf("expected Add to set the same bits as AddHash with the XXH64 hash value of the input")
+	}
+}
+
+func TestSplitBlockBloomFilter(t *testing.T) {
+	var (
+		count     = 100000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	tests := prepTestCases(count, minStrLen, maxStrLen)
+	negatives := prepTestCases(count, minStrLen, maxStrLen)
+
+	sbbf, err := NewSplitBlockByEstimates(numItems, fp)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	for _, tt := range tests {
+		sbbf.Add(tt.data)
+	}
+
+	data, err := sbbf.MarshalBinary()
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	var loaded SplitBlockBloomFilter
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	for _, tt := range tests {
+		if result := loaded.Query(tt.data); !result {
+			t.Errorf("Query(%v): expected %v, actual %v", string(tt.data), true, false)
+		}
+	}
+
+	fps := 0
+	for _, tt := range negatives {
+		if loaded.Query(tt.data) {
+			fps++
+		}
+	}
+	if rate := float64(fps) / float64(count); rate > fp*(1+acceptableAdditionalFalsePositiveErrorRate) {
+		t.Errorf("expected false positive rate close to %v, actual %v", fp, rate)
+	}
+}
+
+func TestSplitBlockBloomFilterUnmarshalErrors(t *testing.T) {
+	for _, n := range []int{0, 1, 31, 33, 48} {
+		var sbbf SplitBlockBloomFilter
+		if err := sbbf.UnmarshalBinary(make([]byte, n)); err != ErrInvalidEncoding {
+			t.Errorf("UnmarshalBinary(%v bytes): expected error %v, actual %v", n, ErrInvalidEncoding, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package bloomfilter
+
+import (
+	"hash"
+	"math"
+	"math/bits"
+	"math/rand"
+	"time"
+)
+
+// StableBloomFilter is a non-thread safe bloom filter data structure for unbounded streams of elements, as described in
+// "Approximately Detecting Duplicates for Streaming Data using Stable Bloom Filters" by Deng and Rafiei.
+//
+// A BloomFilter that elements are added to forever saturates until every Query returns true. A StableBloomFilter
+// keeps a small cell instead of a single bit at every location, and every Add first decrements a number of randomly
+// chosen cells by one and then sets the cells of its element to their maximum value. Old elements are forgotten
+// as their cells are decremented to zero, and the fraction of zero cells converges to a stable point, so the false
+// positive rate stays bounded however many elements are added, at the cost of false negatives for elements that
+// were added long ago. The more cells, the longer elements are remembered.
+type StableBloomFilter struct {
+	hasher           Hasher
+	numHashFunctions uint8
+	size             uint64 // number of cells
+	numDecrements    uint64 // number of cells that are decremented by every Add
+	cells            counters
+	rnd              *rand.Rand
+}
+
+// Add takes a byte slice as input, decrements numDecrements randomly chosen cells of the StableBloomFilter structure
+// that are not already zero, and sets the cells of the input to their maximum value.
+func (stbf *StableBloomFilter) Add(data []byte) {
+	hash1Val, hash2Val := stbf.hasher.Sum128(data)
+
+	for i := uint64(0); i < stbf.numDecrements; i++ {
+		loc, _ := bits.Mul64(stbf.rnd.Uint64(), stbf.size)
+		if c := stbf.cells.get(loc); c > 0 {
+			stbf.cells.set(loc, c-1)
+		}
+	}
+	for i := uint8(0); i < stbf.numHashFunctions; i++ {
+		stbf.cells.set(location(hash1Val, hash2Val, i, stbf.size), stbf.cells.max)
+	}
+}
+
+// Query tests the byte slice input's existence in the StableBloomFilter structure and returns a boolean value.
+// Unlike BloomFilter, both false positives and false negatives are possible: an element that was added long ago
+// may have been forgotten.
+func (stbf *StableBloomFilter) Query(data []byte) bool {
+	hash1Val, hash2Val := stbf.hasher.Sum128(data)
+
+	for i := uint8(0); i < stbf.numHashFunctions; i++ {
+		if stbf.cells.get(location(hash1Val, hash2Val, i, stbf.size)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NumDecrements returns the number of cells that are decremented by every Add, which is called P by Deng and Rafiei.
+func (stbf *StableBloomFilter) NumDecrements() uint64 {
+	return stbf.numDecrements
+}
+
+// StableFPRate returns the false positive rate that the StableBloomFilter structure converges to as elements are added,
+// which is never more than the fpRate it was created with.
+func (stbf *StableBloomFilter) StableFPRate() float64 {
+	return stableFPRate(stbf.size, stbf.numHashFunctions, stbf.numDecrements, stbf.cells.max)
+}
+
+// stableZeroRatio returns the fraction of zero cells at the stable point of a stable bloom filter of size cells
+// with a maximum value of max, numHashFunctions hash functions K and numDecrements decrements P per Add,
+// which is (1 / (1 + 1/(P * (1/K - 1/size))))^max.
+func stableZeroRatio(size uint64, numHashFunctions uint8, numDecrements uint64, max uint64) float64 {
+	p := float64(numDecrements) * (1/float64(numHashFunctions) - 1/float64(size))
+	return math.Pow(1/(1+1/p), float64(max))
+}
+
+// stableFPRate returns the false positive rate at the stable point, which is (1 - stableZeroRatio)^K.
+func stableFPRate(size uint64, numHashFunctions uint8, numDecrements uint64, max uint64) float64 {
+	return math.Pow(1-stableZeroRatio(size, numHashFunctions, numDecrements, max), float64(numHashFunctions))
+}
+
+// stableNumDecrements returns the number of decrements P per Add for which the false positive rate at the stable point
+// is fpRate, which is stableFPRate solved for P. It is not rounded.
+func stableNumDecrements(size uint64, numHashFunctions uint8, max uint64, fpRate float64) float64 {
+	k := float64(numHashFunctions)
+	zeroRatio := -math.Expm1(math.Log(fpRate) / k) // 1 - fpRate^(1/K)
+	return 1 / ((math.Pow(zeroRatio, -1/float64(max)) - 1) * (1/k - 1/float64(size)))
+}
+
+// NewStable requires the number of cells, the false positive rate that must hold however many elements are added,
+// and the width of each cell in bits, which is 1, 2, 4 or 8, to create a StableBloomFilter structure.
+// The number of hash functions is the ideal one for fpRate, as in NewByEstimates, and the number of decrements
+// per Add is the smallest one whose stable false positive rate is at most fpRate. Wider cells remember elements
+// more evenly but need more decrements per Add; Deng and Rafiei found cells of a few bits to work well.
+// ErrInvalidSize is returned when size is not more than the number of hash functions, or when even decrementing
+// size cells per Add does not keep the stable false positive rate at most fpRate, which happens for small sizes
+// with wide cells and a low fpRate.
+// src is the source of the random cells that are decremented, and it can be set to a source with a fixed seed such as
+// rand.NewSource(1) for reproducible results. When it is nil, a source seeded with the current time is used.
+// hash.Hash64 hash1 and hash.Hash64 hash2 can be nil and when they are nil, a default hash.Hash64 for each will be used.
+func NewStable(size uint64, fpRate float64, cellWidth uint8, src rand.Source, hash1 hash.Hash64, hash2 hash.Hash64) (*StableBloomFilter, error) {
+	return NewStableWithHasher(size, fpRate, cellWidth, src, hasherOf(hash1, hash2))
+}
+
+// NewStableWithHasher returns a new StableBloomFilter structure. For more details, please see NewStable function.
+// h can be nil and when it is nil, the Hasher returned by NewFNVHasher will be used.
+func NewStableWithHasher(size uint64, fpRate float64, cellWidth uint8, src rand.Source, h Hasher) (*StableBloomFilter, error) {
+	if size == 0 {
+		return nil, ErrInvalidSize
+	}
+	if size > MaxSize {
+		return nil, ErrSizeOverflow
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, ErrInvalidFalsePositiveRate
+	}
+	if cellWidth != 1 && cellWidth != 2 && cellWidth != 4 && cellWidth != 8 {
+		return nil, ErrInvalidCellWidth
+	}
+	k := math.Ceil(-math.Log2(fpRate))
+	if k > MaxHashFunctions {
+		return nil, ErrTooManyHashFunctions
+	}
+	numHashFunctions := uint8(k)
+	if size <= uint64(numHashFunctions) {
+		return nil, ErrInvalidSize
+	}
+	if h == nil {
+		h = fnvHasher{}
+	}
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+
+	cells := newCounters(size, cellWidth)
+	numDecrements := math.Ceil(stableNumDecrements(size, numHashFunctions, cells.max, fpRate))
+	if !(numDecrements <= float64(size)) {
+		return nil, ErrInvalidSize
+	}
+	if numDecrements < 1 {
+		numDecrements = 1
+	}
+
+	stbf := StableBloomFilter{
+		hasher:           h,
+		numHashFunctions: numHashFunctions,
+		size:             size,
+		numDecrements:    uint64(numDecrements),
+		cells:            cells,
+		rnd:              rand.New(src),
+	}
+
+	return &stbf, nil
+}
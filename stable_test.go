@@ -0,0 +1,167 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"hash/crc64"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestStableBloomFilterInit(t *testing.T) {
+	tests := []struct {
+		description string
+		size        uint64
+		fpRate      float64
+		cellWidth   uint8
+		err         error
+	}{
+		{"zero size", 0, 0.01, 2, ErrInvalidSize},
+		{"size of the number of hash functions", 7, 0.01, 2, ErrInvalidSize},
+		{"overflow", MaxSize + 1, 0.01, 2, ErrSizeOverflow},
+		{"false positive rate of 0", 1000, 0, 2, ErrInvalidFalsePositiveRate},
+		{"false positive rate of 1", 1000, 1.0, 2, ErrInvalidFalsePositiveRate},
+		{"false positive rate of NaN", 1000, math.NaN(), 2, ErrInvalidFalsePositiveRate},
+		{"cell width of 0", 1000, 0.01, 0, ErrInvalidCellWidth},
+		{"cell width of 3", 1000, 0.01, 3, ErrInvalidCellWidth},
+		{"too many hash functions", 1000, math.Pow(2, -256), 2, ErrTooManyHashFunctions},
+		{"too few cells for the false positive rate", 100, 0.01, 8, ErrInvalidSize},
+		{"too few 1 bit cells for the false positive rate", 20, 1e-6, 1, ErrInvalidSize},
+	}
+	for _, tt := range tests {
+		if stbf, err := NewStable(tt.size, tt.fpRate, tt.cellWidth, nil, nil, nil); stbf != nil || err != tt.err {
+			t.Errorf("%v: expected nil stable bloom filter and error %v, actual %v and %v", tt.description, tt.err, stbf, err)
+		}
+	}
+
+	// the stable false positive rate of the smallest sizes that are accepted must still be at most fpRate
+	for _, cellWidth := range []uint8{1, 2, 4, 8} {
+		for size := uint64(8); size <= 1000; size++ {
+			stbf, err := NewStable(size, 0.01, cellWidth, nil, nil, nil)
+			if err == ErrInvalidSize {
+				continue
+			}
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			if rate := stbf.StableFPRate(); rate > 0.01 || stbf.NumDecrements() > size {
+				t.Errorf("NewStable(%v, 0.01, %v): expected a stable false positive rate of at most 0.01 with at most %v decrements, actual %v and %v",
+					size, cellWidth, size, rate, stbf.NumDecrements())
+			}
+			break
+		}
+	}
+}
+
+// The number of decrements must be the smallest one whose stable false positive rate is at most fpRate.
+func TestStableBloomFilterParameters(t *testing.T) {
+	for _, fpRate := range []float64{0.1, 0.01, 0.001} {
+		for _, cellWidth := range []uint8{1, 2, 4, 8} {
+			stbf, err := NewStable(1000000, fpRate, cellWidth, nil, nil, nil)
+			if err != nil {
+				t.Log(err.Error())
+				t.FailNow()
+			}
+			if k := uint8(math.Ceil(-math.Log2(fpRate))); stbf.numHashFunctions != k {
+				t.Errorf("NewStable(1000000, %v, %v): expected %v hash functions, actual %v", fpRate, cellWidth, k, stbf.numHashFunctions)
+			}
+			p, max := stbf.NumDecrements(), stbf.cells.max
+			if rate := stbf.StableFPRate(); rate > fpRate || stableFPRate(stbf.size, stbf.numHashFunctions, p-1, max) <= fpRate {
+				t.Errorf("NewStable(1000000, %v, %v): expected the fewest decrements for a stable false positive rate of at most %v, actual %v decrements and %v",
+					fpRate, cellWidth, fpRate, p, rate)
+			}
+		}
+	}
+
+	// Deng and Rafiei's example: 1 bit cells and 1% false positives take 7 hash functions and 7 decrements
+	stbf, err := NewStable(1000000, 0.01, 1, nil, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if stbf.numHashFunctions != 7 || stbf.NumDecrements() != 7 {
+		t.Errorf("expected 7 hash functions and 7 decrements, actual %v and %v", stbf.numHashFunctions, stbf.NumDecrements())
+	}
+}
+
+// Streams many times longer than the number of cells must neither saturate the filter nor forget the latest elements.
+func TestStableBloomFilterStream(t *testing.T) {
+	var (
+		size     = uint64(100000)
+		fp       = 0.01
+		count    = 1000000
+		recent   = 100 // with 1 bit cells, every Add clears 7 of the 100000 cells
+		negative = 100000
+	)
+
+	for _, cellWidth := range []uint8{1, 2, 4} {
+		stbf, err := NewStableWithHasher(size, fp, cellWidth, rand.NewSource(1), NewXXHasher(0))
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		data := make([]byte, 8)
+		for i := 0; i < count; i++ {
+			binary.LittleEndian.PutUint64(data, uint64(i))
+			stbf.Add(data)
+			if result := stbf.Query(data); !result {
+				t.Errorf("Query(%v) right after Add: expected %v, actual %v", i, true, false)
+			}
+		}
+
+		found := 0
+		for i := count - recent; i < count; i++ {
+			binary.LittleEndian.PutUint64(data, uint64(i))
+			if stbf.Query(data) {
+				found++
+			}
+		}
+		if ratio := float64(found) / float64(recent); ratio < 0.9 {
+			t.Errorf("cell width %v: expected most of the last %v elements to be found, actual %v", cellWidth, recent, ratio)
+		}
+
+		fps := 0
+		for i := count; i < count+negative; i++ {
+			binary.LittleEndian.PutUint64(data, uint64(i))
+			if stbf.Query(data) {
+				fps++
+			}
+		}
+		if rate := float64(fps) / float64(negative); rate > fp*(1+acceptableAdditionalFalsePositiveErrorRate) {
+			t.Errorf("cell width %v: expected false positive rate close to %v, actual %v", cellWidth, fp, rate)
+		}
+	}
+}
+
+// Filters with sources of the same seed must decrement the same cells.
+func TestStableBloomFilterDeterministic(t *testing.T) {
+	tests := prepTestCases(10000, 20, 50)
+	cells := func(seed int64) []uint64 {
+		stbf, err := NewStable(10000, 0.01, 2, rand.NewSource(seed), nil, crc64.New(crc64Table))
+		if err != nil {
+			t.Log(err.Error())
+			t.FailNow()
+		}
+		for _, tt := range tests {
+			stbf.Add(tt.data)
+		}
+		return stbf.cells.words
+	}
+	equal := func(a, b []uint64) bool {
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	first := cells(7)
+	if second := cells(7); !equal(first, second) {
+		t.Errorf("expected filters with the same seed to have the same cells")
+	}
+	if other := cells(8); equal(first, other) {
+		t.Errorf("expected filters with different seeds to have different cells")
+	}
+}
@@ -0,0 +1,93 @@
+package bloomfilter
+
+import (
+	"math"
+)
+
+// Stats holds statistics about how saturated a bloom filter is.
+type Stats struct {
+	// Size is the size of the bit array in bits.
+	Size uint64
+
+	// NumHashFunctions is the number of hash functions.
+	NumHashFunctions uint8
+
+	// BitsSet is the number of bits that are set in the bit array.
+	BitsSet uint64
+
+	// FillRatio is the ratio of BitsSet to Size.
+	FillRatio float64
+
+	// EstimatedFPRate is the false positive rate of a Query for an element that was not added,
+	// estimated from FillRatio.
+	EstimatedFPRate float64
+
+	// Count is the number of times Add was called, including for elements that were already added.
+	Count uint64
+
+	// Capacity is the estimated number of items that the bloom filter was created for. For bloom filters that were
+	// created by size and number of hash functions, it is the number of items for which the number of hash functions is ideal.
+	Capacity uint64
+}
+
+// capacityOf returns the number of items for which numHashFunctions is the ideal number of hash functions
+// of a bloom filter of size bits.
+func capacityOf(size uint64, numHashFunctions uint8) uint64 {
+	return uint64(math.Log(2) * float64(size) / float64(numHashFunctions))
+}
+
+// estimatedFPRate returns the false positive rate of the BloomFilter structure estimated from its fill ratio,
+// which is the probability that all bits of an element that was not added are set.
+func (bf *BloomFilter) estimatedFPRate() float64 {
+	return math.Pow(float64(bf.bitsSet)/float64(bf.size), float64(bf.numHashFunctions))
+}
+
+// Stats returns statistics about how saturated the BloomFilter structure is.
+func (bf *BloomFilter) Stats() Stats {
+	return Stats{
+		Size:             bf.size,
+		NumHashFunctions: bf.numHashFunctions,
+		BitsSet:          bf.bitsSet,
+		FillRatio:        float64(bf.bitsSet) / float64(bf.size),
+		EstimatedFPRate:  bf.estimatedFPRate(),
+		Count:            bf.count,
+		Capacity:         bf.capacity,
+	}
+}
+
+// SetFPRateThreshold sets a function that is called once, by the Add call that makes the estimated false positive rate
+// of the BloomFilter structure reach threshold, with the statistics right after that call.
+// It can be used to rebuild or replace a bloom filter that is no longer fit for the number of items it holds.
+// When the estimated false positive rate is already at or above threshold, fn is called by the next Add.
+// Calling SetFPRateThreshold again replaces the previous threshold and function, and a nil fn removes them.
+// fn may send to a channel to notify other goroutines, but it should not block.
+func (bf *BloomFilter) SetFPRateThreshold(threshold float64, fn func(Stats)) {
+	bf.fpRateThreshold = threshold
+	bf.onThreshold = fn
+	bf.thresholdFired = false
+}
+
+// passedThreshold reports whether the estimated false positive rate reached the threshold set by SetFPRateThreshold
+// for the first time, in which case the function set by SetFPRateThreshold must be called.
+func (bf *BloomFilter) passedThreshold() bool {
+	if bf.onThreshold == nil || bf.thresholdFired || bf.estimatedFPRate() < bf.fpRateThreshold {
+		return false
+	}
+	bf.thresholdFired = true
+	return true
+}
+
+// Stats for thread safe BloomFilterTS structure serves the same purpose as Stats for BloomFilter structure.
+func (bfts *BloomFilterTS) Stats() Stats {
+	bfts.mtx.RLock()
+	defer bfts.mtx.RUnlock()
+	return bfts.bf.Stats()
+}
+
+// SetFPRateThreshold for thread safe BloomFilterTS structure serves the same purpose as SetFPRateThreshold
+// for BloomFilter structure. fn is called without holding the lock, so it may call methods of the BloomFilterTS structure.
+func (bfts *BloomFilterTS) SetFPRateThreshold(threshold float64, fn func(Stats)) {
+	bfts.mtx.Lock()
+	defer bfts.mtx.Unlock()
+	bfts.bf.SetFPRateThreshold(threshold, fn)
+}
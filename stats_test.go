@@ -0,0 +1,109 @@
+package bloomfilter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBloomFilterStats(t *testing.T) {
+	var (
+		count     = 10000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	bf, err := NewByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	stats := bf.Stats()
+	if stats.Size != bf.size || stats.NumHashFunctions != bf.numHashFunctions || stats.Capacity != numItems {
+		t.Errorf("unexpected statistics %+v for an empty bloom filter of %v bits, %v hash functions and %v items", stats, bf.size, bf.numHashFunctions, numItems)
+	}
+	if stats.BitsSet != 0 || stats.FillRatio != 0 || stats.EstimatedFPRate != 0 || stats.Count != 0 {
+		t.Errorf("unexpected statistics %+v for an empty bloom filter", stats)
+	}
+
+	for _, tt := range prepTestCases(count, minStrLen, maxStrLen) {
+		bf.Add(tt.data)
+	}
+	stats = bf.Stats()
+	if stats.Count != numItems {
+		t.Errorf("expected count %v, actual %v", numItems, stats.Count)
+	}
+	if stats.BitsSet != bf.popcount() {
+		t.Errorf("expected %v bits set, actual %v", bf.popcount(), stats.BitsSet)
+	}
+	// a bloom filter at capacity is about half full
+	if math.Abs(stats.FillRatio-0.5) > 0.05 {
+		t.Errorf("expected fill ratio to be about %v, actual %v", 0.5, stats.FillRatio)
+	}
+	if math.Abs(stats.EstimatedFPRate-fp) > acceptableAdditionalFalsePositiveErrorRate*fp {
+		t.Errorf("expected estimated false positive rate to be about %v, actual %v", fp, stats.EstimatedFPRate)
+	}
+
+	bfts, err := NewTSBySizeAndNumHashFuncs(1000, 7, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if c := bfts.Stats().Capacity; c != 99 {
+		t.Errorf("expected capacity %v, actual %v", 99, c)
+	}
+}
+
+func TestBloomFilterFPRateThreshold(t *testing.T) {
+	var (
+		count     = 10000
+		numItems  = uint64(count)
+		fp        = 0.01
+		maxStrLen = 50
+		minStrLen = 20
+	)
+
+	bfts, err := NewTSByEstimates(numItems, fp, nil, nil)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+
+	notify := make(chan Stats, 1)
+	bfts.SetFPRateThreshold(fp, func(stats Stats) {
+		// the lock is not held, so calling methods must not deadlock
+		bfts.Stats()
+		notify <- stats
+	})
+
+	tests := prepTestCases(2*count, minStrLen, maxStrLen)
+	fired := -1
+	for i, tt := range tests {
+		bfts.Add(tt.data)
+		select {
+		case stats := <-notify:
+			if fired >= 0 {
+				t.Errorf("expected the threshold function to be called once, it was called again after %v items", i+1)
+			}
+			fired = i
+			if stats.EstimatedFPRate < fp || stats.Count != uint64(i+1) {
+				t.Errorf("unexpected statistics %+v after %v items", stats, i+1)
+			}
+		default:
+		}
+	}
+	if fired < 0 {
+		t.Errorf("expected the threshold function to be called")
+	} else if fired < count/2 || fired > 2*count {
+		t.Errorf("expected the threshold to be passed at about %v items, it was passed at %v", count, fired+1)
+	}
+
+	// the threshold is already passed, so setting it again calls the function with the next Add
+	called := false
+	bfts.SetFPRateThreshold(fp, func(stats Stats) { called = true })
+	bfts.Add([]byte("data"))
+	if !called {
+		t.Errorf("expected the threshold function to be called")
+	}
+}